@@ -3,7 +3,6 @@ package main
 import (
 	"flag"
 	"gomongojwt/internal/server"
-	"gomongojwt/internal/util"
 	"io"
 	"log"
 	"os"
@@ -14,11 +13,18 @@ import (
 var (
 	configPath string
 	resetKeys  string
+	dev        bool
+	seedFile   string
 )
 
+// seedCmd loads fixtures into the database: server [flags] seed [-file path]
+var seedCmd = flag.NewFlagSet("seed", flag.ExitOnError)
+
 func init() {
 	flag.StringVar(&configPath, "config", "configs/default.yaml", "server and db configuration")
-	flag.StringVar(&resetKeys, "resetKeys", "y", "reset rs512 keys or not")
+	flag.StringVar(&resetKeys, "resetKeys", "n", "rotate signing keys on start or not")
+	flag.BoolVar(&dev, "dev", false, "run without MongoDB, keeping data in memory")
+	seedCmd.StringVar(&seedFile, "file", "configs/seed.yaml", "YAML or JSON fixtures to load")
 }
 
 // @title Swagger Example API
@@ -36,6 +42,10 @@ func init() {
 // @host localhost:5005
 // @BasePath /
 
+// @securityDefinitions.apikey Bearer
+// @in header
+// @name Authorization
+
 func main() {
 	flag.Parse()
 	file, err := os.Open(configPath)
@@ -50,8 +60,22 @@ func main() {
 	if err = yaml.Unmarshal(data, config); err != nil {
 		log.Fatal("Failed to parse config")
 	}
+	// applied before the subcommands, so seed refuses -dev instead of
+	// seeding the configured database
+	if dev {
+		config.Dev = true
+	}
+	if flag.Arg(0) == seedCmd.Name() {
+		seedCmd.Parse(flag.Args()[1:])
+		if err = server.Seed(config, seedFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if resetKeys == "Y" || resetKeys == "y" {
-		util.SeedRS512Keys()
+		if err = server.ResetKeys(config); err != nil {
+			log.Fatal(err)
+		}
 	}
 	if err = server.StartServer(config); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,98 @@
+// Package metrics holds the Prometheus collectors of the service.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gomongojwt"
+
+// Registry holds every collector of the service along with the Go runtime
+// and process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to handle HTTP requests by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Credential logins by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	Refreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refreshes_total",
+		Help:      "Token refreshes by result and failure reason.",
+	}, []string{"result", "reason"})
+
+	HashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hash_duration_seconds",
+		Help:      "Time spent hashing and verifying passwords (argon2id) and refresh tokens (bcrypt).",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"algorithm", "operation"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by the rate limiter, by reason (rate or lockout).",
+	}, []string{"reason"})
+
+	DBDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_operation_duration_seconds",
+		Help:      "Latency of MongoDB repository operations by collection and operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"collection", "operation"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RequestDuration,
+		Logins,
+		Refreshes,
+		HashDuration,
+		RateLimited,
+		DBDuration,
+	)
+}
+
+// RegisterActiveSessions exposes the number of active sessions, counted by
+// count on every scrape.
+func RegisterActiveSessions(count func() float64) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "Sessions that are not revoked and can still be refreshed.",
+	}, count))
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Result labels a counted outcome.
+func Result(reason string) string {
+	if reason == "" {
+		return "success"
+	}
+	return "failure"
+}
+
+// ObserveHash records the time since start for a hash operation.
+func ObserveHash(algorithm, operation string, start time.Time) {
+	HashDuration.WithLabelValues(algorithm, operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	EventRefreshReuse = "refresh_token_reuse"
+)
+
+type AuditEvent struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Type      string             `bson:"type" json:"type"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	SessionID primitive.ObjectID `bson:"session_id,omitempty" json:"session_id,omitempty"`
+	UserAgent string             `bson:"user_agent" json:"user_agent"`
+	IP        string             `bson:"ip" json:"ip"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
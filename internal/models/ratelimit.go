@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RateLimit is the token bucket and failure count of one client IP or user.
+// Version increases with every save, so concurrent updates can be detected.
+type RateLimit struct {
+	Key         string    `bson:"_id"`
+	Tokens      float64   `bson:"tokens"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+	Failures    int       `bson:"failures"`
+	FailedAt    time.Time `bson:"failed_at,omitempty"`
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+	Version     int64     `bson:"version"`
+}
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// RevokedToken is an access token denied before its expiry, keyed by jti.
+type RevokedToken struct {
+	ID        string    `bson:"_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a single device login. Every refresh token issued for it belongs
+// to the same family; Generation counts rotations and Retired keeps the hashes
+// of rotated tokens so that their reuse can be detected.
+type Session struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RefreshHash string             `bson:"refresh_hash" json:"-"`
+	Generation  int                `bson:"generation" json:"-"`
+	Retired     []RetiredRefresh   `bson:"retired,omitempty" json:"-"`
+	Access      AccessToken        `bson:"access" json:"-"`
+	Revoked     bool               `bson:"revoked" json:"-"`
+	RevokedAt   time.Time          `bson:"revoked_at,omitempty" json:"-"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt  time.Time          `bson:"last_used_at" json:"last_used_at"`
+	UserAgent   string             `bson:"user_agent" json:"user_agent"`
+	IP          string             `bson:"ip" json:"ip"`
+}
+
+// AccessToken references the latest access token issued for a session, so it
+// can be revoked along with the session.
+type AccessToken struct {
+	ID        string    `bson:"id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type RetiredRefresh struct {
+	Generation int    `bson:"generation"`
+	Hash       string `bson:"hash"`
+}
+
+// Hash returns the refresh hash stored for the given generation.
+func (s *Session) Hash(generation int) (string, bool) {
+	if generation == s.Generation {
+		return s.RefreshHash, true
+	}
+	for _, r := range s.Retired {
+		if r.Generation == generation {
+			return r.Hash, true
+		}
+	}
+	return "", false
+}
@@ -3,7 +3,10 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type User struct {
-	GUID         primitive.ObjectID `bson:"_id"`
+	GUID         primitive.ObjectID `bson:"_id" json:"id"`
 	Name         string             `json:"name" validate:"required,min=3"`
-	RefreshToken string             `json:"refresh"`
+	Login        string             `bson:"login,omitempty" json:"login" validate:"required,min=3"`
+	PasswordHash string             `bson:"password_hash,omitempty" json:"-"`
+	Disabled     bool               `bson:"disabled,omitempty" json:"disabled"`
+	Admin        bool               `bson:"admin,omitempty" json:"admin"`
 }
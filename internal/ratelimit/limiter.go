@@ -0,0 +1,170 @@
+// Package ratelimit throttles clients with token buckets and locks keys out
+// after repeated failures. The state lives in a repository.LimitRepository, so
+// instances sharing a MongoDB collection share their limits.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"math"
+	"time"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreMongo  = "mongo"
+)
+
+var (
+	ErrRateLimited = errors.New("rate limit exceeded")
+	ErrLockedOut   = errors.New("locked out after repeated failures")
+)
+
+// maxAttempts bounds the retries of an update that keeps losing to
+// concurrent ones; the last ErrLimitConflict is returned.
+const maxAttempts = 5
+
+// Rule is a token bucket: Burst requests at once, refilled at Rate per second.
+// A zero rule doesn't limit.
+type Rule struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Lockout locks a key out for Base after Threshold failures, doubling with
+// every further failure up to Max. Failures are forgotten once the key has
+// been quiet for Window. A zero Threshold disables lockouts.
+type Lockout struct {
+	Threshold int           `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	Base      time.Duration `yaml:"base"`
+	Max       time.Duration `yaml:"max"`
+}
+
+type Config struct {
+	Enabled bool    `yaml:"enabled"`
+	Store   string  `yaml:"store"` // memory or mongo
+	IP      Rule    `yaml:"ip"`
+	User    Rule    `yaml:"user"`
+	Lockout Lockout `yaml:"lockout"`
+	// addresses or CIDR ranges of reverse proxies whose forwarding headers
+	// are trusted
+	TrustedProxies []string `yaml:"trustedproxies"`
+}
+
+type Limiter struct {
+	limits  repository.LimitRepository
+	lockout Lockout
+	now     func() time.Time
+}
+
+func New(limits repository.LimitRepository, lockout Lockout) *Limiter {
+	return &Limiter{limits: limits, lockout: lockout, now: time.Now}
+}
+
+func IPKey(ip string) string       { return "ip:" + ip }
+func UserKey(guid string) string   { return "user:" + guid }
+func LoginKey(login string) string { return "login:" + login }
+
+// Allow takes a token from the bucket of key. If there is none it fails with
+// ErrRateLimited, and with ErrLockedOut while the key is locked out; the
+// duration is how long the client should wait.
+func (l *Limiter) Allow(ctx context.Context, key string, rule Rule) (wait time.Duration, err error) {
+	err = l.update(ctx, key, func(limit *models.RateLimit, now time.Time) (bool, error) {
+		if limit.LockedUntil.After(now) {
+			wait = limit.LockedUntil.Sub(now)
+			return false, ErrLockedOut
+		}
+		if rule.Rate <= 0 || rule.Burst <= 0 {
+			return false, nil
+		}
+		tokens := float64(rule.Burst)
+		if !limit.UpdatedAt.IsZero() {
+			tokens = min(tokens, limit.Tokens+now.Sub(limit.UpdatedAt).Seconds()*rule.Rate)
+		}
+		if tokens < 1 {
+			wait = time.Duration((1 - tokens) / rule.Rate * float64(time.Second))
+			return false, ErrRateLimited
+		}
+		limit.Tokens = tokens - 1
+		limit.UpdatedAt = now
+		full := now.Add(time.Duration((float64(rule.Burst) - limit.Tokens) / rule.Rate * float64(time.Second)))
+		limit.ExpiresAt = later(limit.ExpiresAt, full)
+		return true, nil
+	})
+	return wait, err
+}
+
+// Fail counts a failed attempt of key and locks it out once there were too
+// many.
+func (l *Limiter) Fail(ctx context.Context, key string) error {
+	if l.lockout.Threshold <= 0 {
+		return nil
+	}
+	return l.update(ctx, key, func(limit *models.RateLimit, now time.Time) (bool, error) {
+		if now.After(later(limit.FailedAt, limit.LockedUntil).Add(l.lockout.Window)) {
+			limit.Failures = 0
+		}
+		limit.Failures++
+		limit.FailedAt = now
+		if over := limit.Failures - l.lockout.Threshold; over >= 0 {
+			limit.LockedUntil = now.Add(l.lockout.duration(over))
+		}
+		limit.ExpiresAt = later(limit.ExpiresAt, later(now, limit.LockedUntil).Add(l.lockout.Window))
+		return true, nil
+	})
+}
+
+// Succeed forgets the failures of key.
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	return l.update(ctx, key, func(limit *models.RateLimit, now time.Time) (bool, error) {
+		if limit.Failures == 0 {
+			return false, nil
+		}
+		limit.Failures = 0
+		limit.FailedAt = time.Time{}
+		return true, nil
+	})
+}
+
+// update applies change to the state of key and saves it if change asks to,
+// starting over when a concurrent update got there first.
+func (l *Limiter) update(ctx context.Context, key string, change func(*models.RateLimit, time.Time) (bool, error)) error {
+	for attempt := 1; ; attempt++ {
+		limit, err := l.limits.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		save, err := change(limit, l.now())
+		if !save || err != nil {
+			return err
+		}
+		err = l.limits.Save(ctx, limit)
+		if !errors.Is(err, repository.ErrLimitConflict) || attempt == maxAttempts {
+			return err
+		}
+	}
+}
+
+// duration is Base doubled over times, saturated at Max, or at the longest
+// duration without one.
+func (o Lockout) duration(over int) time.Duration {
+	limit := o.Max
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	shift := min(over, 20)
+	if o.Base > limit>>shift {
+		return limit
+	}
+	return o.Base << shift
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
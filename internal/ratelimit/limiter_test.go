@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/repository/memory"
+	"math"
+	"testing"
+	"time"
+)
+
+// clock is a fake clock. It starts at the real time, because the memory
+// repository drops entries that expired by the real one.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func testLimiter(lockout Lockout) (*Limiter, *clock) {
+	c := &clock{now: time.Now()}
+	l := New(memory.NewLimitRep(), lockout)
+	l.now = c.Now
+	return l, c
+}
+
+func TestAllow(t *testing.T) {
+	ctx := context.Background()
+	l, c := testLimiter(Lockout{})
+	rule := Rule{Rate: 2, Burst: 3}
+	for i, step := range []struct {
+		advance time.Duration
+		err     error
+		wait    time.Duration
+	}{
+		{0, nil, 0},
+		{0, nil, 0},
+		{0, nil, 0},
+		{0, ErrRateLimited, 500 * time.Millisecond},
+		{200 * time.Millisecond, ErrRateLimited, 300 * time.Millisecond},
+		{300 * time.Millisecond, nil, 0},
+		{0, ErrRateLimited, 500 * time.Millisecond},
+		// the bucket refills up to the burst only
+		{time.Hour, nil, 0},
+		{0, nil, 0},
+		{0, nil, 0},
+		{0, ErrRateLimited, 500 * time.Millisecond},
+	} {
+		c.advance(step.advance)
+		wait, err := l.Allow(ctx, IPKey("192.0.2.1"), rule)
+		if !errors.Is(err, step.err) || (wait-step.wait).Abs() > time.Millisecond {
+			t.Fatalf("step %d: got %v, %v, want %v, %v", i, wait, err, step.wait, step.err)
+		}
+	}
+	if _, err := l.Allow(ctx, IPKey("192.0.2.2"), rule); err != nil {
+		t.Fatalf("another key: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := l.Allow(ctx, IPKey("192.0.2.1"), Rule{}); err != nil {
+			t.Fatalf("a zero rule limited: %v", err)
+		}
+	}
+}
+
+func TestLockout(t *testing.T) {
+	ctx := context.Background()
+	key := LoginKey("bonnie")
+	l, c := testLimiter(Lockout{Threshold: 3, Window: time.Minute, Base: 10 * time.Second, Max: 35 * time.Second})
+	for i, step := range []struct {
+		advance time.Duration
+		fail    bool
+		locked  time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, true, 10 * time.Second},
+		{10 * time.Second, false, 0},
+		{0, true, 20 * time.Second},
+		{20 * time.Second, true, 35 * time.Second},
+		{35 * time.Second, true, 35 * time.Second},
+		// failures are forgotten after the window
+		{35*time.Second + time.Minute + time.Second, true, 0},
+	} {
+		c.advance(step.advance)
+		if step.fail {
+			if err := l.Fail(ctx, key); err != nil {
+				t.Fatalf("step %d: %v", i, err)
+			}
+		}
+		wait, err := l.Allow(ctx, key, Rule{})
+		if step.locked == 0 {
+			if err != nil {
+				t.Fatalf("step %d: got %v, want no lockout", i, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrLockedOut) || wait != step.locked {
+			t.Fatalf("step %d: got %v, %v, want %v, %v", i, wait, err, step.locked, ErrLockedOut)
+		}
+	}
+
+	if err := l.Fail(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Succeed(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.Fail(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := l.Allow(ctx, key, Rule{}); err != nil {
+		t.Fatalf("locked out after Succeed reset the failures: %v", err)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	for _, tt := range []struct {
+		lockout Lockout
+		over    int
+		want    time.Duration
+	}{
+		{Lockout{Base: time.Second}, 0, time.Second},
+		{Lockout{Base: time.Second}, 3, 8 * time.Second},
+		{Lockout{Base: time.Second}, 100, time.Second << 20},
+		{Lockout{Base: time.Hour, Max: 2 * time.Hour}, 5, 2 * time.Hour},
+		{Lockout{Base: 100 * 365 * 24 * time.Hour}, 20, math.MaxInt64},
+		{Lockout{Base: 100 * 365 * 24 * time.Hour, Max: time.Hour}, 20, time.Hour},
+		{Lockout{Base: math.MaxInt64 / 2, Max: math.MaxInt64 - 1}, 1, math.MaxInt64 - 1},
+	} {
+		if got := tt.lockout.duration(tt.over); got != tt.want {
+			t.Errorf("%+v, %d over: got %v, want %v", tt.lockout, tt.over, got, tt.want)
+		}
+	}
+}
+
+// conflictRep loses every save to a concurrent update.
+type conflictRep struct{ saves int }
+
+func (r *conflictRep) Get(ctx context.Context, key string) (*models.RateLimit, error) {
+	return &models.RateLimit{Key: key}, nil
+}
+func (r *conflictRep) Save(ctx context.Context, limit *models.RateLimit) error {
+	r.saves++
+	return repository.ErrLimitConflict
+}
+
+func TestUpdateGivesUp(t *testing.T) {
+	limits := &conflictRep{}
+	l := New(limits, Lockout{Threshold: 1})
+	if _, err := l.Allow(context.Background(), IPKey("192.0.2.1"), Rule{Rate: 1, Burst: 1}); !errors.Is(err, repository.ErrLimitConflict) {
+		t.Fatalf("got %v, want %v", err, repository.ErrLimitConflict)
+	}
+	if limits.saves != maxAttempts {
+		t.Fatalf("saved %d times, want %d", limits.saves, maxAttempts)
+	}
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Proxies are the reverse proxies trusted to report the client address in
+// X-Forwarded-For or X-Real-IP.
+type Proxies []netip.Prefix
+
+// ParseProxies parses addresses and CIDR ranges.
+func ParseProxies(addrs []string) (Proxies, error) {
+	proxies := make(Proxies, 0, len(addrs))
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr)
+		if err != nil {
+			ip, ipErr := netip.ParseAddr(addr)
+			if ipErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", addr)
+			}
+			prefix = netip.PrefixFrom(ip, ip.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (p Proxies) trusts(addr string) bool {
+	ip, err := netip.ParseAddr(strings.TrimSpace(addr))
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the peer, unless it is a trusted proxy.
+// Then it is the right-most address in X-Forwarded-For that isn't a trusted
+// proxy, or X-Real-IP without that header; the left-most entries can be
+// forged by the client.
+func (p Proxies) ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !p.trusts(ip) {
+		return ip
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if !p.trusts(hop) {
+				if _, err := netip.ParseAddr(hop); err != nil {
+					return ip
+				}
+				return hop
+			}
+			ip = hop
+		}
+		return ip
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); real != "" {
+		if _, err := netip.ParseAddr(real); err == nil {
+			return real
+		}
+	}
+	return ip
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name      string
+		peer      string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"untrusted peer", "203.0.113.5:1234", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.5"},
+		{"untrusted IPv6 peer", "[2001:db9::1]:80", []string{"198.51.100.1"}, "", "2001:db9::1"},
+		{"proxy without headers", "10.1.2.3:80", nil, "", "10.1.2.3"},
+		{"single hop", "10.1.2.3:80", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed left-most hop", "10.1.2.3:80", []string{"6.6.6.6, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of proxies", "192.0.2.1:80", []string{"6.6.6.6, 198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"repeated headers", "10.1.2.3:80", []string{"6.6.6.6", "198.51.100.1"}, "", "198.51.100.1"},
+		{"only proxies", "10.1.2.3:80", []string{"10.0.0.3, 10.0.0.2"}, "", "10.0.0.3"},
+		{"garbage hop", "10.1.2.3:80", []string{"6.6.6.6, garbage"}, "", "10.1.2.3"},
+		{"garbage behind proxy", "10.1.2.3:80", []string{"garbage, 10.0.0.2"}, "", "10.0.0.2"},
+		{"real ip", "10.1.2.3:80", nil, "198.51.100.1", "198.51.100.1"},
+		{"forwarded wins over real ip", "10.1.2.3:80", []string{"198.51.100.1"}, "6.6.6.6", "198.51.100.1"},
+		{"garbage real ip", "10.1.2.3:80", nil, "garbage", "10.1.2.3"},
+		{"mapped IPv4 proxy", "[::ffff:10.1.2.3]:80", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"IPv6 proxy", "[2001:db8::1]:80", []string{"2001:db9::5"}, "", "2001:db9::5"},
+		{"peer without port", "10.1.2.3", []string{"198.51.100.1"}, "", "198.51.100.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/login", nil)
+			r.RemoteAddr = tt.peer
+			for _, hops := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", hops)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "10.1.2.3:80"
+	r.Header.Set("X-Forwarded-For", "6.6.6.6")
+	if got := Proxies(nil).ClientIP(r); got != "10.1.2.3" {
+		t.Errorf("no trusted proxies: got %s, want 10.1.2.3", got)
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.1.2.3/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := proxies[0].String(); got != "10.0.0.0/8" {
+		t.Errorf("got %s, want 10.0.0.0/8", got)
+	}
+	if got := proxies[1].String(); got != "192.0.2.1/32" {
+		t.Errorf("got %s, want 192.0.2.1/32", got)
+	}
+	for _, addr := range []string{"", "localhost", "10.0.0.0/33", "10.0.0.1:80"} {
+		if _, err := ParseProxies([]string{addr}); err == nil {
+			t.Errorf("%q: no error", addr)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AuditRepository interface {
+	Record(ctx context.Context, event *models.AuditEvent) error
+}
+
+type AuditRep struct {
+	store      *Store
+	collection *mongo.Collection
+}
+
+func (r *AuditRep) Record(ctx context.Context, event *models.AuditEvent) error {
+	defer observe(r.collection, "record")()
+	_, err := r.collection.InsertOne(ctx, event)
+	return err
+}
@@ -0,0 +1,47 @@
+package repository
+
+// Config names the collections the repositories use. The keys collection is
+// only used with the mongo keystore storage.
+type Config struct {
+	Users      string `yaml:"users"`
+	Sessions   string `yaml:"sessions"`
+	Audit      string `yaml:"audit"`
+	Revoked    string `yaml:"revoked"`
+	RateLimits string `yaml:"ratelimits"`
+	Keys       string `yaml:"keys"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Users:      "users",
+		Sessions:   "sessions",
+		Audit:      "audit",
+		Revoked:    "revoked",
+		RateLimits: "rate_limits",
+		Keys:       "keys",
+	}
+}
+
+// withDefaults fills in the names left empty.
+func (c Config) withDefaults() Config {
+	def := DefaultConfig()
+	if c.Users == "" {
+		c.Users = def.Users
+	}
+	if c.Sessions == "" {
+		c.Sessions = def.Sessions
+	}
+	if c.Audit == "" {
+		c.Audit = def.Audit
+	}
+	if c.Revoked == "" {
+		c.Revoked = def.Revoked
+	}
+	if c.RateLimits == "" {
+		c.RateLimits = def.RateLimits
+	}
+	if c.Keys == "" {
+		c.Keys = def.Keys
+	}
+	return c
+}
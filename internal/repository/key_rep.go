@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/util"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// keySetID is the _id of the single document holding the keystore.
+const keySetID = "keystore"
+
+// KeyStore is implemented by backends that can hold the signing keys shared
+// by every instance of the service.
+type KeyStore interface {
+	Keys() util.KeyStorage
+}
+
+// KeyRep keeps the keystore manifest and the private keys in one document,
+// so a rotation replaces them at once and only if no other instance rotated
+// since they were loaded.
+type KeyRep struct {
+	store      *Store
+	collection *mongo.Collection
+}
+
+type keySetDoc struct {
+	ID      string   `bson:"_id"`
+	Version int64    `bson:"version"`
+	Keys    []keyDoc `bson:"keys"`
+}
+type keyDoc struct {
+	ID          string        `bson:"kid"`
+	Alg         string        `bson:"alg"`
+	State       util.KeyState `bson:"state"`
+	CreatedAt   time.Time     `bson:"created_at"`
+	ActivatedAt time.Time     `bson:"activated_at,omitempty"`
+	RetiredAt   time.Time     `bson:"retired_at,omitempty"`
+	PEM         []byte        `bson:"pem"`
+}
+
+func (r *KeyRep) Load(ctx context.Context) (*util.KeySet, error) {
+	defer observe(r.collection, "load")()
+	doc := &keySetDoc{}
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: keySetID}}).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &util.KeySet{PEM: map[string][]byte{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	set := &util.KeySet{
+		Keys:    make([]util.KeyInfo, 0, len(doc.Keys)),
+		PEM:     make(map[string][]byte, len(doc.Keys)),
+		Version: doc.Version,
+	}
+	for _, key := range doc.Keys {
+		set.Keys = append(set.Keys, util.KeyInfo{
+			ID:          key.ID,
+			Alg:         key.Alg,
+			State:       key.State,
+			CreatedAt:   key.CreatedAt,
+			ActivatedAt: key.ActivatedAt,
+			RetiredAt:   key.RetiredAt,
+		})
+		set.PEM[key.ID] = key.PEM
+	}
+	return set, nil
+}
+func (r *KeyRep) Save(ctx context.Context, set *util.KeySet) error {
+	defer observe(r.collection, "save")()
+	doc := &keySetDoc{ID: keySetID, Version: set.Version + 1}
+	for _, key := range set.Keys {
+		doc.Keys = append(doc.Keys, keyDoc{
+			ID:          key.ID,
+			Alg:         key.Alg,
+			State:       key.State,
+			CreatedAt:   key.CreatedAt,
+			ActivatedAt: key.ActivatedAt,
+			RetiredAt:   key.RetiredAt,
+			PEM:         set.PEM[key.ID],
+		})
+	}
+	if set.Version == 0 {
+		_, err := r.collection.InsertOne(ctx, doc)
+		if mongo.IsDuplicateKeyError(err) {
+			return util.ErrKeysChanged
+		} else if err != nil {
+			return err
+		}
+		set.Version = doc.Version
+		return nil
+	}
+	res, err := r.collection.ReplaceOne(ctx, bson.D{
+		{Key: "_id", Value: keySetID},
+		{Key: "version", Value: set.Version},
+	}, doc)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return util.ErrKeysChanged
+	}
+	set.Version = doc.Version
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrLimitConflict = errors.New("rate limit was changed by a concurrent request")
+
+type LimitRepository interface {
+	// Get returns the state of key, or a zero one with Version 0 if there is none.
+	Get(ctx context.Context, key string) (*models.RateLimit, error)
+	// Save stores limit if it is still at the version it was read at and
+	// increments the version; otherwise it fails with ErrLimitConflict.
+	Save(ctx context.Context, limit *models.RateLimit) error
+}
+
+// LimitStore is implemented by backends that can hold rate limits shared by
+// every instance of the service.
+type LimitStore interface {
+	Limit() LimitRepository
+}
+
+// LimitRep keeps rate limits in MongoDB. Idle entries are removed by a TTL
+// index on expires_at.
+type LimitRep struct {
+	store      *Store
+	collection *mongo.Collection
+}
+
+func (r *LimitRep) ensureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+func (r *LimitRep) Get(ctx context.Context, key string) (*models.RateLimit, error) {
+	defer observe(r.collection, "get")()
+	limit := &models.RateLimit{}
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(limit)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.RateLimit{Key: key}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+func (r *LimitRep) Save(ctx context.Context, limit *models.RateLimit) error {
+	defer observe(r.collection, "save")()
+	version := limit.Version
+	limit.Version++
+	if version == 0 {
+		_, err := r.collection.InsertOne(ctx, limit)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrLimitConflict
+		}
+		return err
+	}
+	res, err := r.collection.ReplaceOne(ctx, bson.D{
+		{Key: "_id", Value: limit.Key},
+		{Key: "version", Value: version},
+	}, limit)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLimitConflict
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"sync"
+)
+
+type AuditRep struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (r *AuditRep) Record(ctx context.Context, event *models.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, *event)
+	return nil
+}
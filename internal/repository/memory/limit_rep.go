@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"sync"
+	"time"
+)
+
+// limitSweep is how often LimitRep drops expired entries.
+const limitSweep = time.Minute
+
+// LimitRep keeps rate limits of a single instance.
+type LimitRep struct {
+	mu      sync.Mutex
+	limits  map[string]models.RateLimit
+	sweptAt time.Time
+}
+
+func NewLimitRep() *LimitRep {
+	return &LimitRep{limits: map[string]models.RateLimit{}}
+}
+func (r *LimitRep) Get(ctx context.Context, key string) (*models.RateLimit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit, ok := r.limits[key]
+	if !ok || !limit.ExpiresAt.After(time.Now()) {
+		return &models.RateLimit{Key: key, Version: limit.Version}, nil
+	}
+	return &limit, nil
+}
+func (r *LimitRep) Save(ctx context.Context, limit *models.RateLimit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.limits[limit.Key].Version != limit.Version {
+		return repository.ErrLimitConflict
+	}
+	limit.Version++
+	r.limits[limit.Key] = *limit
+	r.dropExpired()
+	return nil
+}
+func (r *LimitRep) dropExpired() {
+	now := time.Now()
+	if now.Sub(r.sweptAt) < limitSweep {
+		return
+	}
+	r.sweptAt = now
+	for key, limit := range r.limits {
+		if !limit.ExpiresAt.After(now) {
+			delete(r.limits, key)
+		}
+	}
+}
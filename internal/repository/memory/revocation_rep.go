@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"sync"
+	"time"
+)
+
+// RevocationRep drops expired entries whenever the active ones are listed.
+type RevocationRep struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func newRevocationRep() *RevocationRep {
+	return &RevocationRep{revoked: map[string]time.Time{}}
+}
+func (r *RevocationRep) Revoke(ctx context.Context, token *models.RevokedToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[token.ID] = token.ExpiresAt
+	return nil
+}
+func (r *RevocationRep) Active(ctx context.Context) ([]models.RevokedToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	tokens := []models.RevokedToken{}
+	for id, expiresAt := range r.revoked {
+		if !expiresAt.After(now) {
+			delete(r.revoked, id)
+			continue
+		}
+		tokens = append(tokens, models.RevokedToken{ID: id, ExpiresAt: expiresAt})
+	}
+	return tokens, nil
+}
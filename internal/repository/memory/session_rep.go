@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SessionRep struct {
+	mu       sync.RWMutex
+	sessions map[primitive.ObjectID]models.Session
+}
+
+func newSessionRep() *SessionRep {
+	return &SessionRep{sessions: map[primitive.ObjectID]models.Session{}}
+}
+
+// clone copies the session so callers can't change the stored one.
+func clone(session models.Session) *models.Session {
+	session.Retired = append([]models.RetiredRefresh(nil), session.Retired...)
+	return &session
+}
+func (r *SessionRep) Create(ctx context.Context, session *models.Session, refresh string) error {
+	hash, err := repository.HashRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	session.RefreshHash = hash
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.ID] = *clone(*session)
+	return nil
+}
+
+// find returns the session of the user. Callers hold mu.
+func (r *SessionRep) find(id, guid string) (models.Session, error) {
+	sid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Session{}, repository.ErrSessionNotFound
+	}
+	session, ok := r.sessions[sid]
+	if !ok || session.UserID.Hex() != guid {
+		return models.Session{}, repository.ErrSessionNotFound
+	}
+	return session, nil
+}
+func (r *SessionRep) CompareRefreshAndHash(ctx context.Context, refresh, id, guid string, generation int) (*models.Session, bool, error) {
+	r.mu.RLock()
+	session, err := r.find(id, guid)
+	r.mu.RUnlock()
+	if err != nil {
+		return nil, false, err
+	}
+	hash, ok := session.Hash(generation)
+	if !ok {
+		return clone(session), false, nil
+	}
+	same, err := repository.CompareRefresh(ctx, hash, refresh)
+	if err != nil {
+		return nil, false, err
+	}
+	return clone(session), same, nil
+}
+
+// Rotate checks the generation and revocation of the stored session under
+// the write lock, so concurrent rotations are serialised.
+func (r *SessionRep) Rotate(ctx context.Context, session *models.Session, refresh string, access models.AccessToken, userAgent, ip string) error {
+	hash, err := repository.HashRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.sessions[session.ID]
+	if !ok || stored.Generation != session.Generation || stored.Revoked {
+		return repository.ErrRefreshConflict
+	}
+	stored.Retired = append(stored.Retired, models.RetiredRefresh{Generation: stored.Generation, Hash: stored.RefreshHash})
+	if len(stored.Retired) > repository.RetiredRefreshLimit {
+		stored.Retired = stored.Retired[len(stored.Retired)-repository.RetiredRefreshLimit:]
+	}
+	stored.RefreshHash = hash
+	stored.Generation++
+	stored.Access = access
+	stored.LastUsedAt = time.Now()
+	stored.UserAgent = userAgent
+	stored.IP = ip
+	r.sessions[session.ID] = stored
+	return nil
+}
+func (r *SessionRep) ListByUser(ctx context.Context, guid string, since time.Time) ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sessions := []models.Session{}
+	for _, session := range r.sessions {
+		if session.UserID.Hex() == guid && !session.Revoked && !session.LastUsedAt.Before(since) {
+			sessions = append(sessions, *clone(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// Revoke returns the session as it was before revoking it.
+func (r *SessionRep) Revoke(ctx context.Context, id, guid string) (*models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, err := r.find(id, guid)
+	if err != nil {
+		return nil, err
+	}
+	revoked := *clone(session)
+	revoked.Revoked = true
+	revoked.RevokedAt = time.Now()
+	r.sessions[session.ID] = revoked
+	return clone(session), nil
+}
+func (r *SessionRep) RevokeByUser(ctx context.Context, guid string) ([]models.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := []models.Session{}
+	now := time.Now()
+	for id, session := range r.sessions {
+		if session.UserID.Hex() != guid || session.Revoked {
+			continue
+		}
+		sessions = append(sessions, *clone(session))
+		session.Revoked = true
+		session.RevokedAt = now
+		r.sessions[id] = session
+	}
+	return sessions, nil
+}
+func (r *SessionRep) CountActive(ctx context.Context, since time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var count int64
+	for _, session := range r.sessions {
+		if !session.Revoked && !session.LastUsedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
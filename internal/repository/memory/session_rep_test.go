@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListByUser(t *testing.T) {
+	ctx := context.Background()
+	sessions := newSessionRep()
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+	newer := &models.Session{ID: primitive.NewObjectID(), UserID: user, CreatedAt: now.Add(-time.Minute), LastUsedAt: now}
+	older := &models.Session{ID: primitive.NewObjectID(), UserID: user, CreatedAt: now.Add(-2 * time.Hour), LastUsedAt: now}
+	for _, session := range []*models.Session{
+		newer,
+		older,
+		{ID: primitive.NewObjectID(), UserID: user, CreatedAt: now.Add(-3 * time.Hour), LastUsedAt: now.Add(-2 * time.Hour)},
+		{ID: primitive.NewObjectID(), UserID: user, CreatedAt: now, LastUsedAt: now, Revoked: true},
+		{ID: primitive.NewObjectID(), UserID: other, CreatedAt: now, LastUsedAt: now},
+	} {
+		if err := sessions.Create(ctx, session, "refresh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := sessions.ListByUser(ctx, user.Hex(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != older.ID || list[1].ID != newer.ID {
+		t.Fatalf("got %+v, want the two sessions used within the hour, oldest first", list)
+	}
+}
@@ -0,0 +1,36 @@
+// Package memory implements the repositories in process memory. Data is lost
+// on restart; it is meant for development and for running the service
+// without a database.
+package memory
+
+import "gomongojwt/internal/repository"
+
+type Store struct {
+	userRep       *UserRep
+	sessionRep    *SessionRep
+	auditRep      *AuditRep
+	revocationRep *RevocationRep
+}
+
+var _ repository.Repositories = (*Store)(nil)
+
+func NewStore() *Store {
+	return &Store{
+		userRep:       newUserRep(),
+		sessionRep:    newSessionRep(),
+		auditRep:      &AuditRep{},
+		revocationRep: newRevocationRep(),
+	}
+}
+func (s *Store) User() repository.UserRepository {
+	return s.userRep
+}
+func (s *Store) Session() repository.SessionRepository {
+	return s.sessionRep
+}
+func (s *Store) Audit() repository.AuditRepository {
+	return s.auditRep
+}
+func (s *Store) Revocation() repository.RevocationRepository {
+	return s.revocationRep
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UserRep struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]models.User
+}
+
+func newUserRep() *UserRep {
+	return &UserRep{users: map[primitive.ObjectID]models.User{}}
+}
+
+// loginTaken reports whether another user has the login. Callers hold mu.
+func (r *UserRep) loginTaken(user *models.User) bool {
+	if user.Login == "" {
+		return false
+	}
+	for id, other := range r.users {
+		if id != user.GUID && other.Login == user.Login {
+			return true
+		}
+	}
+	return false
+}
+func (r *UserRep) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.GUID]; ok || r.loginTaken(user) {
+		return repository.ErrLoginTaken
+	}
+	r.users[user.GUID] = *user
+	return nil
+}
+func (r *UserRep) FindByID(ctx context.Context, guid string) (*models.User, error) {
+	id, err := primitive.ObjectIDFromHex(guid)
+	if err != nil {
+		return nil, repository.ErrUserNotFound
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	usr, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	return &usr, nil
+}
+func (r *UserRep) FindByLogin(ctx context.Context, login string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, usr := range r.users {
+		if usr.Login == login {
+			return &usr, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+func (r *UserRep) List(ctx context.Context, filter repository.UserFilter) ([]models.User, int64, error) {
+	name := strings.ToLower(filter.Name)
+	r.mu.RLock()
+	users := []models.User{}
+	for _, usr := range r.users {
+		if strings.Contains(strings.ToLower(usr.Name), name) {
+			users = append(users, usr)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].GUID.Hex() < users[j].GUID.Hex()
+	})
+	total := int64(len(users))
+	start := max(0, min(filter.Skip, total))
+	end := total
+	if filter.Limit > 0 && filter.Limit < total-start {
+		end = start + filter.Limit
+	}
+	return users[start:end], total, nil
+}
+func (r *UserRep) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.GUID]; !ok {
+		return repository.ErrUserNotFound
+	}
+	if r.loginTaken(user) {
+		return repository.ErrLoginTaken
+	}
+	r.users[user.GUID] = *user
+	return nil
+}
+func (r *UserRep) Delete(ctx context.Context, guid string) error {
+	id, err := primitive.ObjectIDFromHex(guid)
+	if err != nil {
+		return repository.ErrUserNotFound
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[id]; !ok {
+		return repository.ErrUserNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
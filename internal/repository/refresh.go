@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"gomongojwt/internal/metrics"
+	"gomongojwt/internal/tracing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashRefresh returns the bcrypt hash a refresh token is stored as. Every
+// backend uses it, so they can read each other's data and are measured alike.
+func HashRefresh(ctx context.Context, refresh string) (_ string, err error) {
+	_, span := tracing.Start(ctx, "repository.HashRefresh")
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveHash("bcrypt", "hash", time.Now())
+	hash, err := bcrypt.GenerateFromPassword([]byte(refresh), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CompareRefresh reports whether refresh matches hash.
+func CompareRefresh(ctx context.Context, hash, refresh string) (_ bool, err error) {
+	_, span := tracing.Start(ctx, "repository.CompareRefresh")
+	defer func() { tracing.End(span, err) }()
+	defer metrics.ObserveHash("bcrypt", "verify", time.Now())
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(refresh))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
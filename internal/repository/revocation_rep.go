@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevocationRepository interface {
+	Revoke(ctx context.Context, token *models.RevokedToken) error
+	Active(ctx context.Context) ([]models.RevokedToken, error)
+}
+
+// RevocationRep stores the access token denylist. Entries are removed by a TTL
+// index on expires_at once the token would have expired anyway.
+type RevocationRep struct {
+	store      *Store
+	collection *mongo.Collection
+}
+
+func (r *RevocationRep) ensureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+func (r *RevocationRep) Revoke(ctx context.Context, token *models.RevokedToken) error {
+	defer observe(r.collection, "revoke")()
+	_, err := r.collection.UpdateByID(ctx, token.ID, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "expires_at", Value: token.ExpiresAt},
+	}}}, options.Update().SetUpsert(true))
+	return err
+}
+
+// Active returns the revoked tokens that haven't expired yet. The TTL monitor
+// runs only once a minute, so expired entries are filtered explicitly.
+func (r *RevocationRep) Active(ctx context.Context) ([]models.RevokedToken, error) {
+	defer observe(r.collection, "active")()
+	cur, err := r.collection.Find(ctx, bson.D{{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}}})
+	if err != nil {
+		return nil, err
+	}
+	tokens := []models.RevokedToken{}
+	if err = cur.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrRefreshConflict = errors.New("session was changed by a concurrent request")
+)
+
+// Number of rotated refresh hashes kept per session for reuse detection.
+const RetiredRefreshLimit = 20
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session, refresh string) error
+	CompareRefreshAndHash(ctx context.Context, refresh, id, guid string, generation int) (*models.Session, bool, error)
+	Rotate(ctx context.Context, session *models.Session, refresh string, access models.AccessToken, userAgent, ip string) error
+	// ListByUser returns the sessions of the user that aren't revoked and were
+	// used since, oldest first.
+	ListByUser(ctx context.Context, guid string, since time.Time) ([]models.Session, error)
+	Revoke(ctx context.Context, id, guid string) (*models.Session, error)
+	RevokeByUser(ctx context.Context, guid string) ([]models.Session, error)
+	// CountActive counts the sessions that aren't revoked and were used since.
+	CountActive(ctx context.Context, since time.Time) (int64, error)
+}
+
+type SessionRep struct {
+	store      *Store
+	collection *mongo.Collection
+}
+
+func (r *SessionRep) ensureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	})
+	return err
+}
+func (r *SessionRep) Create(ctx context.Context, session *models.Session, refresh string) error {
+	defer observe(r.collection, "create")()
+	hash, err := HashRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	session.RefreshHash = hash
+	_, err = r.collection.InsertOne(ctx, session)
+	return err
+}
+
+// CompareRefreshAndHash loads the session and checks refresh against the hash
+// of the given generation, which may be the current or an already rotated one.
+func (r *SessionRep) CompareRefreshAndHash(ctx context.Context, refresh, id, guid string, generation int) (*models.Session, bool, error) {
+	defer observe(r.collection, "compare_refresh_and_hash")()
+	sid, uid, err := sessionIDs(id, guid)
+	if err != nil {
+		return nil, false, err
+	}
+	res := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: sid}, {Key: "user_id", Value: uid}})
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, false, ErrSessionNotFound
+	} else if res.Err() != nil {
+		return nil, false, res.Err()
+	}
+	session := &models.Session{}
+	if err = res.Decode(session); err != nil {
+		return nil, false, err
+	}
+	hash, ok := session.Hash(generation)
+	if !ok {
+		return session, false, nil
+	}
+	same, err := CompareRefresh(ctx, hash, refresh)
+	if err != nil {
+		return nil, false, err
+	}
+	return session, same, nil
+}
+
+// Rotate stores refresh as the next generation of the session and moves the
+// current hash to the retired list. It only applies if the session is still
+// at the generation it was read at and not revoked, so of two concurrent
+// rotations of the same token one fails with ErrRefreshConflict.
+func (r *SessionRep) Rotate(ctx context.Context, session *models.Session, refresh string, access models.AccessToken, userAgent, ip string) error {
+	defer observe(r.collection, "rotate")()
+	hash, err := HashRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	res, err := r.collection.UpdateOne(ctx, bson.D{
+		{Key: "_id", Value: session.ID},
+		{Key: "generation", Value: session.Generation},
+		{Key: "revoked", Value: false},
+	}, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "refresh_hash", Value: hash},
+			{Key: "generation", Value: session.Generation + 1},
+			{Key: "access", Value: access},
+			{Key: "last_used_at", Value: time.Now()},
+			{Key: "user_agent", Value: userAgent},
+			{Key: "ip", Value: ip},
+		}},
+		{Key: "$push", Value: bson.D{{Key: "retired", Value: bson.D{
+			{Key: "$each", Value: bson.A{models.RetiredRefresh{Generation: session.Generation, Hash: session.RefreshHash}}},
+			{Key: "$slice", Value: -RetiredRefreshLimit},
+		}}}},
+	})
+	if err != nil {
+		return err
+	} else if res.MatchedCount == 0 {
+		return ErrRefreshConflict
+	}
+	return nil
+}
+
+func (r *SessionRep) ListByUser(ctx context.Context, guid string, since time.Time) ([]models.Session, error) {
+	defer observe(r.collection, "list_by_user")()
+	uid, err := primitive.ObjectIDFromHex(guid)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := r.collection.Find(ctx, bson.D{
+		{Key: "user_id", Value: uid},
+		{Key: "revoked", Value: false},
+		{Key: "last_used_at", Value: bson.D{{Key: "$gte", Value: since}}},
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	sessions := []models.Session{}
+	if err = cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke invalidates the whole refresh token family of the session.
+func (r *SessionRep) Revoke(ctx context.Context, id, guid string) (*models.Session, error) {
+	defer observe(r.collection, "revoke")()
+	sid, uid, err := sessionIDs(id, guid)
+	if err != nil {
+		return nil, err
+	}
+	res := r.collection.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: sid}, {Key: "user_id", Value: uid}}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "revoked", Value: true},
+		{Key: "revoked_at", Value: time.Now()},
+	}}})
+	session := &models.Session{}
+	if err = res.Decode(session); err == mongo.ErrNoDocuments {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// sessionIDs parses the session and user ids. Malformed ids can't match any
+// session.
+func sessionIDs(id, guid string) (sid, uid primitive.ObjectID, err error) {
+	if sid, err = primitive.ObjectIDFromHex(id); err != nil {
+		return sid, uid, ErrSessionNotFound
+	}
+	if uid, err = primitive.ObjectIDFromHex(guid); err != nil {
+		return sid, uid, ErrSessionNotFound
+	}
+	return sid, uid, nil
+}
+
+// RevokeByUser revokes every session of the user that isn't revoked yet,
+// including expired ones, and returns them.
+func (r *SessionRep) RevokeByUser(ctx context.Context, guid string) ([]models.Session, error) {
+	defer observe(r.collection, "revoke_by_user")()
+	sessions, err := r.ListByUser(ctx, guid, time.Time{})
+	if err != nil || len(sessions) == 0 {
+		return sessions, err
+	}
+	ids := make(bson.A, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	_, err = r.collection.UpdateMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "revoked", Value: true},
+		{Key: "revoked_at", Value: time.Now()},
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+func (r *SessionRep) CountActive(ctx context.Context, since time.Time) (int64, error) {
+	defer observe(r.collection, "count_active")()
+	return r.collection.CountDocuments(ctx, bson.D{
+		{Key: "revoked", Value: false},
+		{Key: "last_used_at", Value: bson.D{{Key: "$gte", Value: since}}},
+	})
+}
@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"gomongojwt/internal/models"
+)
+
+type AuditRep struct {
+	db *sql.DB
+}
+
+func (r *AuditRep) Record(ctx context.Context, event *models.AuditEvent) error {
+	var sessionID string
+	if !event.SessionID.IsZero() {
+		sessionID = event.SessionID.Hex()
+	}
+	_, err := r.db.ExecContext(ctx, `INSERT INTO audit (id, type, user_id, session_id, user_agent, ip, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		event.ID.Hex(), event.Type, event.UserID.Hex(), sessionID, event.UserAgent, event.IP, toUnix(event.CreatedAt))
+	return err
+}
@@ -0,0 +1,41 @@
+CREATE TABLE users (
+	id            TEXT PRIMARY KEY,
+	name          TEXT NOT NULL,
+	login         TEXT UNIQUE,
+	password_hash TEXT NOT NULL DEFAULT '',
+	disabled      INTEGER NOT NULL DEFAULT 0,
+	admin         INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE sessions (
+	id                TEXT PRIMARY KEY,
+	user_id           TEXT NOT NULL,
+	refresh_hash      TEXT NOT NULL,
+	generation        INTEGER NOT NULL DEFAULT 0,
+	retired           TEXT NOT NULL DEFAULT '[]',
+	access_id         TEXT NOT NULL DEFAULT '',
+	access_expires_at INTEGER NOT NULL DEFAULT 0,
+	revoked           INTEGER NOT NULL DEFAULT 0,
+	revoked_at        INTEGER NOT NULL DEFAULT 0,
+	created_at        INTEGER NOT NULL,
+	last_used_at      INTEGER NOT NULL,
+	user_agent        TEXT NOT NULL DEFAULT '',
+	ip                TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+
+CREATE TABLE audit (
+	id         TEXT PRIMARY KEY,
+	type       TEXT NOT NULL,
+	user_id    TEXT NOT NULL,
+	session_id TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip         TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE revoked (
+	id         TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX revoked_expires_at ON revoked (expires_at);
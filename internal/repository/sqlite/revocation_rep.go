@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"gomongojwt/internal/models"
+	"time"
+)
+
+// RevocationRep drops expired entries whenever the active ones are listed,
+// as SQLite has no TTL index.
+type RevocationRep struct {
+	db *sql.DB
+}
+
+func (r *RevocationRep) Revoke(ctx context.Context, token *models.RevokedToken) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO revoked (id, expires_at) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at`,
+		token.ID, toUnix(token.ExpiresAt))
+	return err
+}
+func (r *RevocationRep) Active(ctx context.Context) ([]models.RevokedToken, error) {
+	now := time.Now().UnixNano()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM revoked WHERE expires_at <= ?`, now); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT id, expires_at FROM revoked`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []models.RevokedToken{}
+	for rows.Next() {
+		var token models.RevokedToken
+		var expiresAt int64
+		if err = rows.Scan(&token.ID, &expiresAt); err != nil {
+			return nil, err
+		}
+		token.ExpiresAt = fromUnix(expiresAt)
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sessionColumns = `id, user_id, refresh_hash, generation, retired, access_id, access_expires_at,
+	revoked, revoked_at, created_at, last_used_at, user_agent, ip`
+
+type SessionRep struct {
+	db *sql.DB
+}
+
+func scanSession(row scanner) (*models.Session, error) {
+	session := &models.Session{}
+	var id, userID, retired string
+	var accessExpiresAt, revokedAt, createdAt, lastUsedAt int64
+	err := row.Scan(&id, &userID, &session.RefreshHash, &session.Generation, &retired,
+		&session.Access.ID, &accessExpiresAt, &session.Revoked, &revokedAt,
+		&createdAt, &lastUsedAt, &session.UserAgent, &session.IP)
+	if err != nil {
+		return nil, err
+	}
+	if session.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if session.UserID, err = primitive.ObjectIDFromHex(userID); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(retired), &session.Retired); err != nil {
+		return nil, err
+	}
+	session.Access.ExpiresAt = fromUnix(accessExpiresAt)
+	session.RevokedAt = fromUnix(revokedAt)
+	session.CreatedAt = fromUnix(createdAt)
+	session.LastUsedAt = fromUnix(lastUsedAt)
+	return session, nil
+}
+func scanSessions(rows *sql.Rows) ([]models.Session, error) {
+	defer rows.Close()
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+func (r *SessionRep) Create(ctx context.Context, session *models.Session, refresh string) error {
+	hash, err := repository.HashRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	session.RefreshHash = hash
+	retired, err := json.Marshal(append([]models.RetiredRefresh{}, session.Retired...))
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID.Hex(), session.UserID.Hex(), session.RefreshHash, session.Generation, string(retired),
+		session.Access.ID, toUnix(session.Access.ExpiresAt), session.Revoked, toUnix(session.RevokedAt),
+		toUnix(session.CreatedAt), toUnix(session.LastUsedAt), session.UserAgent, session.IP)
+	return err
+}
+func (r *SessionRep) CompareRefreshAndHash(ctx context.Context, refresh, id, guid string, generation int) (*models.Session, bool, error) {
+	session, err := scanSession(r.db.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ? AND user_id = ?`, id, guid))
+	if err == sql.ErrNoRows {
+		return nil, false, repository.ErrSessionNotFound
+	} else if err != nil {
+		return nil, false, err
+	}
+	hash, ok := session.Hash(generation)
+	if !ok {
+		return session, false, nil
+	}
+	same, err := repository.CompareRefresh(ctx, hash, refresh)
+	if err != nil {
+		return nil, false, err
+	}
+	return session, same, nil
+}
+
+// Rotate updates the row with a WHERE on the generation read and revoked = 0.
+// The retired list is derived from the session as read, which that check
+// guarantees is still current.
+func (r *SessionRep) Rotate(ctx context.Context, session *models.Session, refresh string, access models.AccessToken, userAgent, ip string) error {
+	hash, err := repository.HashRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	retired := append(append([]models.RetiredRefresh{}, session.Retired...),
+		models.RetiredRefresh{Generation: session.Generation, Hash: session.RefreshHash})
+	if len(retired) > repository.RetiredRefreshLimit {
+		retired = retired[len(retired)-repository.RetiredRefreshLimit:]
+	}
+	retiredJSON, err := json.Marshal(retired)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, `UPDATE sessions SET refresh_hash = ?, generation = ?, retired = ?,
+		access_id = ?, access_expires_at = ?, last_used_at = ?, user_agent = ?, ip = ?
+		WHERE id = ? AND generation = ? AND revoked = 0`,
+		hash, session.Generation+1, string(retiredJSON),
+		access.ID, toUnix(access.ExpiresAt), time.Now().UnixNano(), userAgent, ip,
+		session.ID.Hex(), session.Generation)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res, repository.ErrRefreshConflict)
+}
+func (r *SessionRep) ListByUser(ctx context.Context, guid string, since time.Time) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND revoked = 0 AND last_used_at >= ? ORDER BY created_at`,
+		guid, toUnix(since))
+	if err != nil {
+		return nil, err
+	}
+	return scanSessions(rows)
+}
+func (r *SessionRep) Revoke(ctx context.Context, id, guid string) (*models.Session, error) {
+	session, err := scanSession(r.db.QueryRowContext(ctx,
+		`UPDATE sessions SET revoked = 1, revoked_at = ? WHERE id = ? AND user_id = ? RETURNING `+sessionColumns,
+		time.Now().UnixNano(), id, guid))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrSessionNotFound
+	}
+	return session, err
+}
+func (r *SessionRep) RevokeByUser(ctx context.Context, guid string) ([]models.Session, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`UPDATE sessions SET revoked = 1, revoked_at = ? WHERE user_id = ? AND revoked = 0 RETURNING `+sessionColumns,
+		time.Now().UnixNano(), guid)
+	if err != nil {
+		return nil, err
+	}
+	return scanSessions(rows)
+}
+func (r *SessionRep) CountActive(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE revoked = 0 AND last_used_at >= ?`,
+		toUnix(since)).Scan(&count)
+	return count, err
+}
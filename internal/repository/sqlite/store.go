@@ -0,0 +1,182 @@
+// Package sqlite implements the repositories on a SQLite database, for
+// deployments that can't run MongoDB.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"gomongojwt/internal/repository"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type Store struct {
+	db            *sql.DB
+	userRep       *UserRep
+	sessionRep    *SessionRep
+	auditRep      *AuditRep
+	revocationRep *RevocationRep
+}
+
+var (
+	_ repository.Repositories = (*Store)(nil)
+	_ repository.Pinger       = (*Store)(nil)
+	_ repository.Migrator     = (*Store)(nil)
+)
+
+// Open opens the database file at path, creating it if needed, and applies
+// the pending migrations.
+func Open(ctx context.Context, path string) (*Store, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{
+		db:            db,
+		userRep:       &UserRep{db: db},
+		sessionRep:    &SessionRep{db: db},
+		auditRep:      &AuditRep{db: db},
+		revocationRep: &RevocationRep{db: db},
+	}
+	if err = s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+func (s *Store) User() repository.UserRepository {
+	return s.userRep
+}
+func (s *Store) Session() repository.SessionRepository {
+	return s.sessionRep
+}
+func (s *Store) Audit() repository.AuditRepository {
+	return s.auditRep
+}
+func (s *Store) Revocation() repository.RevocationRepository {
+	return s.revocationRep
+}
+
+// migrate applies the files in migrations in the order of their numeric
+// prefix, each in its own transaction, and records them in
+// schema_migrations.
+func (s *Store) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return err
+	}
+	current, err := s.Version(ctx)
+	if err != nil {
+		return err
+	}
+	files, err := migrationFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.version <= current {
+			continue
+		}
+		script, err := fs.ReadFile(migrations, file.name)
+		if err != nil {
+			return err
+		}
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", file.name, err)
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			file.version, time.Now().UnixNano()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) CheckMigrations(ctx context.Context) error {
+	current, err := s.Version(ctx)
+	if err != nil {
+		return err
+	}
+	files, err := migrationFiles()
+	if err != nil {
+		return err
+	}
+	if latest := files[len(files)-1].version; current < latest {
+		return fmt.Errorf("schema is at version %d, latest is %d", current, latest)
+	}
+	return nil
+}
+
+// Version returns the last applied migration.
+func (s *Store) Version(ctx context.Context) (int, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+type migrationFile struct {
+	name    string
+	version int
+}
+
+func migrationFiles() ([]migrationFile, error) {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	files := make([]migrationFile, 0, len(names))
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "migrations/"), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no numeric prefix", name)
+		}
+		files = append(files, migrationFile{name, version})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].version < files[j].version
+	})
+	return files, nil
+}
+
+// Times are stored as Unix nanoseconds, with 0 for the zero time.
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+func fromUnix(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
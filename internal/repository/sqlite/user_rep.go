@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const userColumns = `id, name, COALESCE(login, ''), password_hash, disabled, admin`
+
+type UserRep struct {
+	db *sql.DB
+}
+
+// nullLogin stores users without a login as NULL, so they don't collide on
+// the unique index.
+func nullLogin(login string) sql.NullString {
+	return sql.NullString{String: login, Valid: login != ""}
+}
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+func (r *UserRep) Create(ctx context.Context, user *models.User) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO users (id, name, login, password_hash, disabled, admin) VALUES (?, ?, ?, ?, ?, ?)`,
+		user.GUID.Hex(), user.Name, nullLogin(user.Login), user.PasswordHash, user.Disabled, user.Admin)
+	if isUniqueViolation(err) {
+		return repository.ErrLoginTaken
+	}
+	return err
+}
+func (r *UserRep) FindByID(ctx context.Context, guid string) (*models.User, error) {
+	return r.findOne(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, guid)
+}
+func (r *UserRep) FindByLogin(ctx context.Context, login string) (*models.User, error) {
+	return r.findOne(ctx, `SELECT `+userColumns+` FROM users WHERE login = ?`, login)
+}
+func (r *UserRep) findOne(ctx context.Context, query string, args ...interface{}) (*models.User, error) {
+	usr, err := scanUser(r.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, repository.ErrUserNotFound
+	}
+	return usr, err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	usr := &models.User{}
+	var id string
+	if err := row.Scan(&id, &usr.Name, &usr.Login, &usr.PasswordHash, &usr.Disabled, &usr.Admin); err != nil {
+		return nil, err
+	}
+	guid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	usr.GUID = guid
+	return usr, nil
+}
+func (r *UserRep) List(ctx context.Context, filter repository.UserFilter) ([]models.User, int64, error) {
+	const where = ` FROM users WHERE instr(lower(name), lower(?)) > 0`
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*)`+where, filter.Name).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+where+` ORDER BY id LIMIT ? OFFSET ?`, filter.Name, limit, max(0, filter.Skip))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	users := []models.User{}
+	for rows.Next() {
+		usr, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *usr)
+	}
+	return users, total, rows.Err()
+}
+func (r *UserRep) Update(ctx context.Context, user *models.User) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET name = ?, login = ?, password_hash = ?, disabled = ?, admin = ? WHERE id = ?`,
+		user.Name, nullLogin(user.Login), user.PasswordHash, user.Disabled, user.Admin, user.GUID.Hex())
+	if isUniqueViolation(err) {
+		return repository.ErrLoginTaken
+	} else if err != nil {
+		return err
+	}
+	return mustAffect(res, repository.ErrUserNotFound)
+}
+func (r *UserRep) Delete(ctx context.Context, guid string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, guid)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res, repository.ErrUserNotFound)
+}
+
+// mustAffect returns notFound if the statement changed no rows.
+func mustAffect(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListBounds(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users := db.User()
+	for _, name := range []string{"bonnie", "clyde", "buck"} {
+		if err := users.Create(ctx, &models.User{GUID: primitive.NewObjectID(), Name: name, Login: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		skip, limit int64
+		want        int
+	}{
+		{0, 0, 3},
+		{1, 1, 1},
+		{2, 5, 1},
+		{-5, 2, 2},
+		{math.MinInt64, 0, 3},
+		{math.MaxInt64, 10, 0},
+		{1, math.MaxInt64, 2},
+		{0, -1, 3},
+	} {
+		list, total, err := users.List(ctx, repository.UserFilter{Skip: tt.skip, Limit: tt.limit})
+		if err != nil {
+			t.Fatalf("skip %d, limit %d: %v", tt.skip, tt.limit, err)
+		}
+		if len(list) != tt.want || total != 3 {
+			t.Errorf("skip %d, limit %d: got %d of %d users, want %d of 3", tt.skip, tt.limit, len(list), total, tt.want)
+		}
+	}
+}
@@ -1,26 +1,139 @@
 package repository
 
 import (
+	"context"
+	"gomongojwt/internal/metrics"
+	"gomongojwt/internal/util"
+	"time"
+
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Repositories gives access to every repository of a storage backend.
+type Repositories interface {
+	User() UserRepository
+	Session() SessionRepository
+	Audit() AuditRepository
+	Revocation() RevocationRepository
+}
+
+// Pinger is implemented by backends that can check their connection.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Migrator is implemented by backends with a versioned schema.
+type Migrator interface {
+	// CheckMigrations fails unless every known migration is applied.
+	CheckMigrations(ctx context.Context) error
+}
+
+// Store is the MongoDB backend.
 type Store struct {
-	db      *mongo.Database
-	userRep UserRepository
+	db            *mongo.Database
+	config        Config
+	userRep       *UserRep
+	sessionRep    *SessionRep
+	auditRep      AuditRepository
+	revocationRep *RevocationRep
+	limitRep      *LimitRep
+	keyRep        *KeyRep
 }
 
-func CreateStore(db *mongo.Database) *Store {
+func CreateStore(db *mongo.Database, config Config) *Store {
 	return &Store{
-		db: db,
+		db:     db,
+		config: config.withDefaults(),
 	}
 }
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Client().Ping(ctx, nil)
+}
+
+// EnsureIndexes creates the indexes the repositories rely on.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	s.User()
+	if err := s.userRep.ensureIndexes(ctx); err != nil {
+		return err
+	}
+	s.Session()
+	if err := s.sessionRep.ensureIndexes(ctx); err != nil {
+		return err
+	}
+	s.Revocation()
+	if err := s.revocationRep.ensureIndexes(ctx); err != nil {
+		return err
+	}
+	s.Limit()
+	return s.limitRep.ensureIndexes(ctx)
+}
 func (s *Store) User() UserRepository {
 	if s.userRep != nil {
 		return s.userRep
 	}
 	s.userRep = &UserRep{
 		store:      s,
-		collection: s.db.Collection("users", nil),
+		collection: s.db.Collection(s.config.Users, nil),
 	}
 	return s.userRep
 }
+func (s *Store) Session() SessionRepository {
+	if s.sessionRep != nil {
+		return s.sessionRep
+	}
+	s.sessionRep = &SessionRep{
+		store:      s,
+		collection: s.db.Collection(s.config.Sessions, nil),
+	}
+	return s.sessionRep
+}
+func (s *Store) Audit() AuditRepository {
+	if s.auditRep != nil {
+		return s.auditRep
+	}
+	s.auditRep = &AuditRep{
+		store:      s,
+		collection: s.db.Collection(s.config.Audit, nil),
+	}
+	return s.auditRep
+}
+func (s *Store) Revocation() RevocationRepository {
+	if s.revocationRep != nil {
+		return s.revocationRep
+	}
+	s.revocationRep = &RevocationRep{
+		store:      s,
+		collection: s.db.Collection(s.config.Revoked, nil),
+	}
+	return s.revocationRep
+}
+func (s *Store) Limit() LimitRepository {
+	if s.limitRep != nil {
+		return s.limitRep
+	}
+	s.limitRep = &LimitRep{
+		store:      s,
+		collection: s.db.Collection(s.config.RateLimits, nil),
+	}
+	return s.limitRep
+}
+func (s *Store) Keys() util.KeyStorage {
+	if s.keyRep != nil {
+		return s.keyRep
+	}
+	s.keyRep = &KeyRep{
+		store:      s,
+		collection: s.db.Collection(s.config.Keys, nil),
+	}
+	return s.keyRep
+}
+
+// observe records the latency of a repository operation on collection. Use as
+// defer observe(r.collection, "operation")().
+func observe(collection *mongo.Collection, operation string) func() {
+	start := time.Now()
+	return func() {
+		metrics.DBDuration.WithLabelValues(collection.Name(), operation).Observe(time.Since(start).Seconds())
+	}
+}
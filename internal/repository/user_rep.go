@@ -2,19 +2,36 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"gomongojwt/internal/models"
-	"time"
+	"regexp"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrLoginTaken   = errors.New("login is already taken")
 )
 
 type UserRepository interface {
-	UpdateRefresh(guid string, refresh string) error
-	CompareRefreshAndHash(refresh, guid string) (bool, error)
+	Create(ctx context.Context, user *models.User) error
+	FindByID(ctx context.Context, guid string) (*models.User, error)
+	FindByLogin(ctx context.Context, login string) (*models.User, error)
+	List(ctx context.Context, filter UserFilter) ([]models.User, int64, error)
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, guid string) error
+}
+
+// UserFilter selects a page of users, optionally only those whose name
+// contains Name, case-insensitively.
+type UserFilter struct {
+	Name  string
+	Skip  int64
+	Limit int64
 }
 
 type UserRep struct {
@@ -22,42 +39,92 @@ type UserRep struct {
 	collection *mongo.Collection
 }
 
-func (r *UserRep) UpdateRefresh(guid string, refresh string) error {
+func (r *UserRep) ensureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "login", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{
+			{Key: "login", Value: bson.D{{Key: "$type", Value: "string"}}},
+		}),
+	})
+	return err
+}
+func (r *UserRep) Create(ctx context.Context, user *models.User) error {
+	defer observe(r.collection, "create")()
+	_, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLoginTaken
+	}
+	return err
+}
+func (r *UserRep) FindByID(ctx context.Context, guid string) (*models.User, error) {
+	defer observe(r.collection, "find_by_id")()
 	id, err := primitive.ObjectIDFromHex(guid)
 	if err != nil {
-		return err
+		return nil, ErrUserNotFound
+	}
+	return r.findOne(ctx, bson.D{{Key: "_id", Value: id}})
+}
+func (r *UserRep) FindByLogin(ctx context.Context, login string) (*models.User, error) {
+	defer observe(r.collection, "find_by_login")()
+	return r.findOne(ctx, bson.D{{Key: "login", Value: login}})
+}
+func (r *UserRep) findOne(ctx context.Context, filter bson.D) (*models.User, error) {
+	res := r.collection.FindOne(ctx, filter)
+	if res.Err() == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	} else if res.Err() != nil {
+		return nil, res.Err()
+	}
+	usr := &models.User{}
+	if err := res.Decode(usr); err != nil {
+		return nil, err
 	}
-	hashToken, err := bcrypt.GenerateFromPassword([]byte(refresh), bcrypt.DefaultCost)
+	return usr, nil
+}
+func (r *UserRep) List(ctx context.Context, filter UserFilter) ([]models.User, int64, error) {
+	defer observe(r.collection, "list")()
+	query := bson.D{}
+	if filter.Name != "" {
+		query = append(query, bson.E{Key: "name", Value: primitive.Regex{Pattern: regexp.QuoteMeta(filter.Name), Options: "i"}})
+	}
+	total, err := r.collection.CountDocuments(ctx, query)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	res, err := r.collection.UpdateByID(ctx, id, bson.D{{Key: "$set", Value: bson.D{{Key: "refreshtoken", Value: string(hashToken)}}}}, options.Update().SetUpsert(true))
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetSkip(filter.Skip).SetLimit(filter.Limit)
+	cur, err := r.collection.Find(ctx, query, opts)
 	if err != nil {
+		return nil, 0, err
+	}
+	users := []models.User{}
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+func (r *UserRep) Update(ctx context.Context, user *models.User) error {
+	defer observe(r.collection, "update")()
+	res, err := r.collection.ReplaceOne(ctx, bson.D{{Key: "_id", Value: user.GUID}}, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLoginTaken
+	} else if err != nil {
 		return err
 	} else if res.MatchedCount == 0 {
-		return mongo.ErrNoDocuments
+		return ErrUserNotFound
 	}
 	return nil
 }
-func (r *UserRep) CompareRefreshAndHash(refresh, guid string) (bool, error) {
+func (r *UserRep) Delete(ctx context.Context, guid string) error {
+	defer observe(r.collection, "delete")()
 	id, err := primitive.ObjectIDFromHex(guid)
 	if err != nil {
-		return false, err
+		return ErrUserNotFound
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	userRes := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}})
-	if userRes.Err() == mongo.ErrNoDocuments {
-		return false, mongo.ErrNoDocuments
-	}
-	usr := &models.User{}
-	if err = userRes.Decode(&usr); err != nil {
-		return false, err
-	}
-	if err = bcrypt.CompareHashAndPassword([]byte(usr.RefreshToken), []byte(refresh)); err != nil {
-		return false, err
+	res, err := r.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		return ErrUserNotFound
 	}
-	return true, nil
+	return nil
 }
@@ -3,33 +3,49 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gomongojwt/internal/metrics"
 	"gomongojwt/internal/middleware"
+	"gomongojwt/internal/ratelimit"
+	"gomongojwt/internal/repository"
 	"gomongojwt/internal/service"
+	"gomongojwt/internal/tracing"
+	"gomongojwt/internal/util"
 	"gomongojwt/internal/util/resperr"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	_ "gomongojwt/docs"
 
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"golang.org/x/exp/slog"
 )
 
 type server struct {
-	logger  *slog.Logger
-	client  *mongo.Client
-	router  *mux.Router
-	service service.Service
-	config  *Config
+	logger   *slog.Logger
+	keys     *util.Keystore
+	store    repository.Repositories
+	router   *mux.Router
+	service  service.Service
+	tokens   *util.Tokens
+	limiter  *ratelimit.Limiter
+	proxies  ratelimit.Proxies
+	config   *Config
+	draining atomic.Bool
 }
 
 func initServer(config *Config) *server {
 	s := &server{
-		client:  nil,
 		service: nil,
 		logger:  initLogger(os.Stdout),
 		router:  mux.NewRouter(),
@@ -49,6 +65,7 @@ func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
 func (s *server) respond(w http.ResponseWriter, r *http.Request, code int, data interface{}, err error) {
+	observeRequest(r, code)
 	w.WriteHeader(code)
 	if err != nil {
 		// response := map[string]string{"error": err.Error()}
@@ -74,6 +91,26 @@ func (s *server) respond(w http.ResponseWriter, r *http.Request, code int, data
 	)
 }
 
+// respondInternal answers 504 if the request ran out of time and 500 for any
+// other unexpected error.
+func (s *server) respondInternal(w http.ResponseWriter, r *http.Request, err error) {
+	if isTimeout(err) {
+		s.respond(w, r, http.StatusGatewayTimeout, nil, resperr.ErrTimeout)
+		return
+	}
+	s.respond(w, r, http.StatusInternalServerError, nil, resperr.ErrInternal)
+}
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err)
+}
+
+func (s *server) clientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IP:        s.proxies.ClientIP(r),
+	}
+}
+
 func (s *server) initRouter() {
 	s.router.PathPrefix("/swagger").Handler(httpSwagger.Handler(
 		httpSwagger.URL(fmt.Sprintf("http://localhost%s/swagger/doc.json", s.config.Port)),
@@ -82,28 +119,149 @@ func (s *server) initRouter() {
 		httpSwagger.DomID("swagger-ui"),
 	)).Methods(http.MethodGet)
 
+	s.router.Use(otelmux.Middleware(tracing.ServiceName, otelmux.WithFilter(traced)))
 	s.router.Use(middleware.LogRequest(s.logger))
-	s.router.HandleFunc("/auth", s.handleAuth).Methods("POST")
-	s.router.HandleFunc("/refresh", s.handleRefresh).Methods("POST")
+	s.router.Use(startTimer)
+	s.router.Use(middleware.Deadline(s.config.RequestTimeout))
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleHealthz).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
+	s.router.HandleFunc("/.well-known/jwks.json", s.handleJWKS).Methods("GET")
+	s.router.HandleFunc("/login", s.limitIP(s.handleLogin)).Methods("POST")
+	s.router.HandleFunc("/refresh", s.limitIP(s.handleRefresh)).Methods("POST")
+	s.router.HandleFunc("/logout", s.limitIP(s.handleLogout)).Methods("POST")
+	s.router.HandleFunc("/logout/all", s.authenticate(s.handleLogoutAll)).Methods("POST")
+	s.router.HandleFunc("/sessions", s.authenticate(s.handleSessions)).Methods("GET")
+	s.router.HandleFunc("/sessions/{id}", s.authenticate(s.handleRevokeSession)).Methods("DELETE")
+	s.router.HandleFunc("/users", s.authenticate(s.requireAdmin(s.handleCreateUser))).Methods("POST")
+	s.router.HandleFunc("/users", s.authenticate(s.requireAdmin(s.handleListUsers))).Methods("GET")
+	s.router.HandleFunc("/users/{id}", s.authenticate(s.requireAdmin(s.handleGetUser))).Methods("GET")
+	s.router.HandleFunc("/users/{id}", s.authenticate(s.requireAdmin(s.handleUpdateUser))).Methods("PATCH")
+	s.router.HandleFunc("/users/{id}", s.authenticate(s.requireAdmin(s.handleDeleteUser))).Methods("DELETE")
+}
+
+// traced leaves scrapes and probes out of the traces.
+func traced(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/metrics", "/healthz", "/readyz":
+		return false
+	}
+	return true
+}
+
+type ctxKey int
+
+const (
+	claimsKey ctxKey = iota
+	startKey
+)
+
+// startTimer records when handling began, for the latency observed in
+// respond.
+func startTimer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), startKey, time.Now())))
+	})
+}
+func observeRequest(r *http.Request, code int) {
+	start, ok := r.Context().Value(startKey).(time.Time)
+	if !ok {
+		return
+	}
+	route := "unmatched"
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+	metrics.RequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(code)).Observe(time.Since(start).Seconds())
+}
+
+// authenticate requires a valid access token in the Authorization header and
+// puts its claims into the request context.
+func (s *server) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || access == "" {
+			s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrMissingToken)
+			return
+		}
+		claims, err := s.service.Authenticate(r.Context(), access)
+		if errors.Is(err, service.ErrTokenRevoked) {
+			s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrTokenRevoked)
+			return
+		} else if err != nil {
+			s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrInvalidToken)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), claimsKey, claims)))
+	}
+}
+
+// requireAdmin only lets enabled administrators through. It must be wrapped
+// by authenticate.
+func (s *server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usr, err := s.service.GetUser(r.Context(), requestClaims(r).User)
+		if errors.Is(err, service.ErrUserNotFound) {
+			s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrUserNotFound)
+			return
+		} else if err != nil {
+			s.respondInternal(w, r, err)
+			return
+		}
+		if !usr.Admin || usr.Disabled {
+			s.respond(w, r, http.StatusForbidden, nil, resperr.ErrAdminRequired)
+			return
+		}
+		next(w, r)
+	}
+}
+func requestClaims(r *http.Request) *util.JWTpayload {
+	claims, _ := r.Context().Value(claimsKey).(*util.JWTpayload)
+	return claims
 }
 
-// AuthorizeUser godoc
-// @Summary      Performs user authorization via tokens
-// @Description  Get Access and Refresh tokens by GUID
+// Login godoc
+// @Summary      Performs user authorization via credentials
+// @Description  Get Access and Refresh tokens by login and password
 // @Tags         Authentication
 // @Accept       json
 // @Produce      json
-// @Param		 guid	query	string true "User's GUID"
-// @Router       /auth [post]
+// @Param		 credentials	body	Credentials	true	"User's login and password"
+// @Router       /login [post]
 // @Success 200 {object} TokenPair
+// @Failure 400 {string}	error
 // @Failure 401 {string}	error
-func (s *server) handleAuth(w http.ResponseWriter, r *http.Request) {
-	guid := r.URL.Query().Get("guid")
-	access, refresh, err := s.service.AuthorizeUser(guid)
+// @Failure 403 {string}	error
+// @Failure 429 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	body := &Credentials{}
+	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
-		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrInvalidGUID)
+		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidRequestBody)
+		return
+	}
+	// the user isn't known before the lookup, so logins are limited by name
+	user := ratelimit.LoginKey(body.Login)
+	if !s.allow(w, r, user, s.config.RateLimit.User) {
+		return
+	}
+	client := s.clientInfo(r)
+	access, refresh, err := s.service.AuthorizeUser(r.Context(), body.Login, body.Password, client)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		s.fail(r, ratelimit.IPKey(client.IP), user)
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrInvalidCredentials)
+		return
+	} else if errors.Is(err, service.ErrUserDisabled) {
+		s.respond(w, r, http.StatusForbidden, nil, resperr.ErrUserDisabled)
+		return
+	} else if err != nil {
+		s.respondInternal(w, r, err)
 		return
 	}
+	s.succeed(r, user)
 	s.respond(w, r, http.StatusOK, TokenPair{
 		Access:  access,
 		Refresh: refresh,
@@ -112,7 +270,7 @@ func (s *server) handleAuth(w http.ResponseWriter, r *http.Request) {
 
 // RefreshTokens godoc
 // @Summary      Refreshes Access and Refresh tokens
-// @Description  Refresh tokens
+// @Description  Issues a new token pair and revokes the presented access token
 // @Tags         Authentication
 // @Accept       json
 // @Produce      json
@@ -121,6 +279,9 @@ func (s *server) handleAuth(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} TokenPair
 // @Failure 400 {string}	error
 // @Failure 401 {string}	error
+// @Failure 403 {string}	error
+// @Failure 409 {string}	error
+// @Failure 429 {string}	error
 func (s *server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	body := &TokenPair{}
 	err := json.NewDecoder(r.Body).Decode(&body)
@@ -128,13 +289,337 @@ func (s *server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidRequestBody)
 		return
 	}
-	newAccess, newRefresh, err := s.service.RefreshTokens(body.Access, body.Refresh)
+	user, ok := s.limitUser(w, r, body.Access)
+	if !ok {
+		return
+	}
+	client := s.clientInfo(r)
+	newAccess, newRefresh, err := s.service.RefreshTokens(r.Context(), body.Access, body.Refresh, client)
 	if err != nil {
-		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrInvalidToken)
+		s.respondRefreshError(w, r, client.IP, user, err)
 		return
 	}
+	s.succeed(r, user)
 	s.respond(w, r, http.StatusOK, TokenPair{
 		Access:  newAccess,
 		Refresh: newRefresh,
 	}, nil)
 }
+
+// respondRefreshError also counts wrong refresh tokens against the client IP and
+// the user key, if any.
+func (s *server) respondRefreshError(w http.ResponseWriter, r *http.Request, ip, user string, err error) {
+	if guessed(err) {
+		s.fail(r, ratelimit.IPKey(ip), user)
+	}
+	switch {
+	case errors.Is(err, util.ErrInvalidSignature):
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrInvalidSignature)
+	case errors.Is(err, util.ErrRefreshExpired):
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrRefreshExpired)
+	case errors.Is(err, service.ErrRefreshMismatch):
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrRefreshMismatch)
+	case errors.Is(err, service.ErrRefreshReused):
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrRefreshReused)
+	case errors.Is(err, service.ErrSessionRevoked):
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrSessionRevoked)
+	case errors.Is(err, service.ErrRefreshConflict):
+		s.respond(w, r, http.StatusConflict, nil, resperr.ErrRefreshConflict)
+	case errors.Is(err, service.ErrUserNotFound):
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrUserNotFound)
+	case errors.Is(err, service.ErrUserDisabled):
+		s.respond(w, r, http.StatusForbidden, nil, resperr.ErrUserDisabled)
+	case isTimeout(err):
+		s.respondInternal(w, r, err)
+	default:
+		s.respond(w, r, http.StatusUnauthorized, nil, resperr.ErrInvalidToken)
+	}
+}
+
+// Logout godoc
+// @Summary      Ends the current session
+// @Description  Revokes the session the token pair was issued for
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Param		 tokenPair	body	TokenPair	true	"Access and Refresh tokens"
+// @Router       /logout [post]
+// @Success 204
+// @Failure 400 {string}	error
+// @Failure 401 {string}	error
+// @Failure 429 {string}	error
+func (s *server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	body := &TokenPair{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidRequestBody)
+		return
+	}
+	user, ok := s.limitUser(w, r, body.Access)
+	if !ok {
+		return
+	}
+	client := s.clientInfo(r)
+	if err = s.service.Logout(r.Context(), body.Access, body.Refresh, client); err != nil {
+		s.respondRefreshError(w, r, client.IP, user, err)
+		return
+	}
+	s.respond(w, r, http.StatusNoContent, nil, nil)
+}
+
+// LogoutAll godoc
+// @Summary      Ends every session of the user
+// @Description  Revokes all sessions of the user the access token belongs to
+// @Tags         Sessions
+// @Produce      json
+// @Security     Bearer
+// @Router       /logout/all [post]
+// @Success 204
+// @Failure 401 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := s.service.LogoutAll(r.Context(), requestClaims(r).User); err != nil {
+		s.respondInternal(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusNoContent, nil, nil)
+}
+
+// Sessions godoc
+// @Summary      Lists active sessions
+// @Description  Get active sessions of the user the access token belongs to
+// @Tags         Sessions
+// @Produce      json
+// @Security     Bearer
+// @Router       /sessions [get]
+// @Success 200 {array} models.Session
+// @Failure 401 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.service.Sessions(r.Context(), requestClaims(r).User)
+	if err != nil {
+		s.respondInternal(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusOK, sessions, nil)
+}
+
+// RevokeSession godoc
+// @Summary      Ends a session
+// @Description  Revokes one of the sessions of the user the access token belongs to
+// @Tags         Sessions
+// @Produce      json
+// @Security     Bearer
+// @Param		 id	path	string true "Session ID"
+// @Router       /sessions/{id} [delete]
+// @Success 204
+// @Failure 401 {string}	error
+// @Failure 404 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	err := s.service.RevokeSession(r.Context(), requestClaims(r).User, mux.Vars(r)["id"])
+	if errors.Is(err, service.ErrSessionNotFound) {
+		s.respond(w, r, http.StatusNotFound, nil, resperr.ErrSessionNotFound)
+		return
+	} else if err != nil {
+		s.respondInternal(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusNoContent, nil, nil)
+}
+
+// JWKS godoc
+// @Summary      Lists token verification keys
+// @Description  Get the pending, active and recently retired public keys as a JWK Set
+// @Tags         Keys
+// @Produce      json
+// @Router       /.well-known/jwks.json [get]
+// @Success 200 {object} util.JWKSet
+// @Failure 500 {string}	error
+func (s *server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := util.GetJWKSet(s.keys)
+	if err != nil {
+		s.respondInternal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	s.respond(w, r, http.StatusOK, set, nil)
+}
+
+// CreateUser godoc
+// @Summary      Creates a user
+// @Description  Create a user with a name, login and password of at least 3, 3 and 8 characters
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param		 user	body	CreateUser	true	"New user"
+// @Router       /users [post]
+// @Success 201 {object} models.User
+// @Failure 400 {string}	error
+// @Failure 401 {string}	error
+// @Failure 403 {string}	error
+// @Failure 409 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	body := &CreateUser{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidRequestBody)
+		return
+	}
+	usr, err := s.service.CreateUser(r.Context(), service.NewUser{
+		Name:     body.Name,
+		Login:    body.Login,
+		Password: body.Password,
+		Admin:    body.Admin,
+	})
+	if err != nil {
+		s.respondUserError(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusCreated, usr, nil)
+}
+
+// ListUsers godoc
+// @Summary      Lists users
+// @Description  Get a page of users, optionally only those whose name contains the given string
+// @Tags         Users
+// @Produce      json
+// @Security     Bearer
+// @Param		 page	query	int		false	"Page number, starting at 1"	default(1)
+// @Param		 limit	query	int		false	"Users per page, at most 100"	default(20)
+// @Param		 name	query	string	false	"Case-insensitive part of the name"
+// @Router       /users [get]
+// @Success 200 {object} UserList
+// @Failure 400 {string}	error
+// @Failure 401 {string}	error
+// @Failure 403 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 20)
+	if err != nil || limit < 1 || limit > 100 {
+		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidQuery)
+		return
+	}
+	// the skip of the page has to fit in an int64
+	page, err := queryInt(r, "page", 1)
+	if err != nil || page < 1 || page-1 > math.MaxInt64/limit {
+		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidQuery)
+		return
+	}
+	users, total, err := s.service.ListUsers(r.Context(), repository.UserFilter{
+		Name:  r.URL.Query().Get("name"),
+		Skip:  (page - 1) * limit,
+		Limit: limit,
+	})
+	if err != nil {
+		s.respondInternal(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusOK, UserList{
+		Users: users,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	}, nil)
+}
+func queryInt(r *http.Request, key string, def int64) (int64, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// GetUser godoc
+// @Summary      Gets a user
+// @Tags         Users
+// @Produce      json
+// @Security     Bearer
+// @Param		 id	path	string true "User ID"
+// @Router       /users/{id} [get]
+// @Success 200 {object} models.User
+// @Failure 401 {string}	error
+// @Failure 403 {string}	error
+// @Failure 404 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	usr, err := s.service.GetUser(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		s.respondUserError(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusOK, usr, nil)
+}
+
+// UpdateUser godoc
+// @Summary      Updates a user
+// @Description  Change the fields present in the body. Disabling a user ends their sessions
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param		 id	path	string true "User ID"
+// @Param		 user	body	UpdateUser	true	"Fields to change"
+// @Router       /users/{id} [patch]
+// @Success 200 {object} models.User
+// @Failure 400 {string}	error
+// @Failure 401 {string}	error
+// @Failure 403 {string}	error
+// @Failure 404 {string}	error
+// @Failure 409 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	body := &UpdateUser{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.respond(w, r, http.StatusBadRequest, nil, resperr.ErrInvalidRequestBody)
+		return
+	}
+	usr, err := s.service.UpdateUser(r.Context(), mux.Vars(r)["id"], service.UserUpdate{
+		Name:     body.Name,
+		Login:    body.Login,
+		Password: body.Password,
+		Disabled: body.Disabled,
+		Admin:    body.Admin,
+	})
+	if err != nil {
+		s.respondUserError(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusOK, usr, nil)
+}
+
+// DeleteUser godoc
+// @Summary      Deletes a user
+// @Description  Delete a user and end their sessions
+// @Tags         Users
+// @Produce      json
+// @Security     Bearer
+// @Param		 id	path	string true "User ID"
+// @Router       /users/{id} [delete]
+// @Success 204
+// @Failure 401 {string}	error
+// @Failure 403 {string}	error
+// @Failure 404 {string}	error
+// @Failure 500 {string}	error
+func (s *server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := s.service.DeleteUser(r.Context(), mux.Vars(r)["id"]); err != nil {
+		s.respondUserError(w, r, err)
+		return
+	}
+	s.respond(w, r, http.StatusNoContent, nil, nil)
+}
+
+func (s *server) respondUserError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidUser):
+		s.respond(w, r, http.StatusBadRequest, nil, err)
+	case errors.Is(err, service.ErrUserNotFound):
+		s.respond(w, r, http.StatusNotFound, nil, resperr.ErrUserNotFound)
+	case errors.Is(err, service.ErrLoginTaken):
+		s.respond(w, r, http.StatusConflict, nil, resperr.ErrLoginTaken)
+	default:
+		s.respondInternal(w, r, err)
+	}
+}
@@ -1,15 +1,89 @@
 package server
 
+import (
+	"gomongojwt/internal/ratelimit"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/tracing"
+	"gomongojwt/internal/util"
+	"time"
+)
+
 type Config struct {
-	Port       string `yaml:"port"`
-	DbHost     string `yaml:"dbhost"`
-	DbPort     string `yaml:"dbport"`
-	Database   string `yaml:"database"`
-	Collection string `yaml:"collection"`
+	Port           string            `yaml:"port"`
+	Dev            bool              `yaml:"dev"`      // same as storage.driver memory
+	SeedFile       string            `yaml:"seedfile"` // fixtures loaded by the memory driver
+	Storage        StorageConfig     `yaml:"storage"`
+	RequestTimeout time.Duration     `yaml:"requesttimeout"`
+	DrainTimeout   time.Duration     `yaml:"draintimeout"`
+	ShutdownDelay  time.Duration     `yaml:"shutdowndelay"`
+	DbHost         string            `yaml:"dbhost"`
+	DbPort         string            `yaml:"dbport"`
+	Mongo          MongoConfig       `yaml:"mongo"`
+	Database       string            `yaml:"database"`
+	Collection     string            `yaml:"collection"` // deprecated, use collections.users
+	Collections    repository.Config `yaml:"collections"`
+	RefreshGrace   time.Duration     `yaml:"refreshgrace"`
+	RevocationSync time.Duration     `yaml:"revocationsync"`
+	KeyStorage     string            `yaml:"keystorage"` // file (keydir) or mongo (collections.keys)
+	KeyDir         string            `yaml:"keydir"`
+	KeySync        time.Duration     `yaml:"keysync"`
+	Algorithm      string            `yaml:"algorithm"`
+	KeyRotation    time.Duration     `yaml:"keyrotation"`
+	KeyOverlap     time.Duration     `yaml:"keyoverlap"`
+	Issuer         string            `yaml:"issuer"`
+	Audience       []string          `yaml:"audience"`
+	Leeway         time.Duration     `yaml:"leeway"`
+	AccessTTL      time.Duration     `yaml:"accessttl"`
+	Tracing        tracing.Config    `yaml:"tracing"`
+	RateLimit      ratelimit.Config  `yaml:"ratelimit"`
 }
 
 func NewConfig() *Config {
 	return &Config{
-		Port: ":5005",
+		Port:           ":5005",
+		SeedFile:       "configs/seed.yaml",
+		Storage:        StorageConfig{Driver: DriverMongo, Path: "data/gomongojwt.db"},
+		RequestTimeout: 10 * time.Second,
+		DrainTimeout:   15 * time.Second,
+		Collections:    repository.DefaultConfig(),
+		RefreshGrace:   24 * time.Hour,
+		RevocationSync: 10 * time.Second,
+		KeyStorage:     KeyStorageFile,
+		KeyDir:         util.KeyPath,
+		KeySync:        time.Minute,
+		Algorithm:      util.AlgRS512,
+		KeyRotation:    7 * 24 * time.Hour,
+		KeyOverlap:     48 * time.Hour,
+		Issuer:         "gomongojwt",
+		Audience:       []string{"gomongojwt"},
+		Leeway:         30 * time.Second,
+		AccessTTL:      5 * time.Minute,
+		Tracing:        tracing.Config{Exporter: tracing.ExporterNone, Endpoint: "localhost:4318", Insecure: true, SampleRatio: 1},
+		RateLimit: ratelimit.Config{
+			Enabled: true,
+			Store:   ratelimit.StoreMemory,
+			IP:      ratelimit.Rule{Rate: 1, Burst: 20},
+			User:    ratelimit.Rule{Rate: 0.2, Burst: 5},
+			Lockout: ratelimit.Lockout{Threshold: 5, Window: 15 * time.Minute, Base: 30 * time.Second, Max: 15 * time.Minute},
+		},
+	}
+}
+
+// Repository returns the collection names, honoring the old single
+// "collection" key for the users collection.
+func (c *Config) Repository() repository.Config {
+	repo := c.Collections
+	if c.Collection != "" {
+		repo.Users = c.Collection
+	}
+	return repo
+}
+
+// StorageDriver returns the configured storage driver, which is always the
+// memory one in dev mode.
+func (c *Config) StorageDriver() string {
+	if c.Dev {
+		return DriverMemory
 	}
+	return c.Storage.Driver
 }
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/repository"
+	"net/http"
+	"time"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+var (
+	errNotStarted   = errors.New("server is starting")
+	errShuttingDown = errors.New("server is shutting down")
+)
+
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Healthz godoc
+// @Summary      Liveness probe
+// @Description  Succeeds while the process is running
+// @Tags         Health
+// @Produce      json
+// @Router       /healthz [get]
+// @Success 200 {object} HealthReport
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.respond(w, r, http.StatusOK, HealthReport{Status: "ok"}, nil)
+}
+
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Checks the storage connection, the signing keys and the schema migrations. Fails while shutting down
+// @Tags         Health
+// @Produce      json
+// @Router       /readyz [get]
+// @Success 200 {object} HealthReport
+// @Failure 503 {object} HealthReport
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+	checks := map[string]error{
+		"keystore": s.checkKeystore(),
+	}
+	if pinger, ok := s.store.(repository.Pinger); ok {
+		checks["storage"] = pinger.Ping(ctx)
+	}
+	if migrator, ok := s.store.(repository.Migrator); ok {
+		checks["migrations"] = migrator.CheckMigrations(ctx)
+	}
+	if s.draining.Load() {
+		checks["shutdown"] = errShuttingDown
+	}
+
+	report := HealthReport{Status: "ok", Checks: map[string]CheckResult{}}
+	code := http.StatusOK
+	for name, err := range checks {
+		if err != nil {
+			report.Checks[name] = CheckResult{Status: "fail", Error: err.Error()}
+			report.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		report.Checks[name] = CheckResult{Status: "ok"}
+	}
+	s.respond(w, r, code, report, nil)
+}
+
+// checkKeystore requires a key that new tokens can be signed with.
+func (s *server) checkKeystore() error {
+	if s.keys == nil {
+		return errNotStarted
+	}
+	_, _, err := s.keys.SigningKey()
+	return err
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/util"
+	"time"
+)
+
+const (
+	KeyStorageFile  = "file"
+	KeyStorageMongo = "mongo"
+)
+
+// openKeystore opens the keystore in keydir, or in the keys collection with
+// the mongo key storage, which needs the mongo storage driver.
+func openKeystore(ctx context.Context, config *Config, store repository.Repositories) (*util.Keystore, error) {
+	storage, err := keyStorage(config, store)
+	if err != nil {
+		return nil, err
+	}
+	return util.NewKeystore(ctx, storage, config.Algorithm, config.KeyOverlap)
+}
+func keyStorage(config *Config, store repository.Repositories) (util.KeyStorage, error) {
+	switch config.KeyStorage {
+	case "", KeyStorageFile:
+		return util.NewDirStorage(config.KeyDir), nil
+	case KeyStorageMongo:
+		if keys, ok := store.(repository.KeyStore); ok {
+			return keys.Keys(), nil
+		}
+		return nil, fmt.Errorf("the %s key storage needs the %s storage driver", KeyStorageMongo, DriverMongo)
+	default:
+		return nil, fmt.Errorf("unknown key storage %q", config.KeyStorage)
+	}
+}
+
+// keySync is how often the keys are reloaded to pick up rotations of other
+// instances; only keys shared through the database need it.
+func (c *Config) keySync() time.Duration {
+	if c.KeyStorage != KeyStorageMongo {
+		return 0
+	}
+	return c.KeySync
+}
+
+// ResetKeys rotates the signing keys once, e.g. after a key leaked.
+func ResetKeys(config *Config) error {
+	ctx := context.Background()
+	var store repository.Repositories
+	if config.KeyStorage == KeyStorageMongo {
+		opened, closeStore, err := openStore(ctx, config)
+		if err != nil {
+			return err
+		}
+		defer closeStore(ctx)
+		store = opened
+	}
+	keys, err := openKeystore(ctx, config, store)
+	if err != nil {
+		return err
+	}
+	return keys.Rotate(ctx)
+}
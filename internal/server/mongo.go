@@ -0,0 +1,143 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+var ErrInvalidMongoConfig = errors.New("invalid mongo configuration")
+
+// MongoConfig configures the database connection. URI may be any standard or
+// mongodb+srv connection string; the other fields override it when set.
+type MongoConfig struct {
+	URI            string        `yaml:"uri"`
+	Username       string        `yaml:"username"`
+	Password       string        `yaml:"password"`
+	AuthSource     string        `yaml:"authsource"`
+	AuthMechanism  string        `yaml:"authmechanism"`
+	TLSCAFile      string        `yaml:"tlscafile"`
+	TLSCertFile    string        `yaml:"tlscertfile"`
+	TLSKeyFile     string        `yaml:"tlskeyfile"` // defaults to tlscertfile
+	ReplicaSet     string        `yaml:"replicaset"`
+	MaxPoolSize    uint64        `yaml:"maxpoolsize"`
+	ReadPreference string        `yaml:"readpreference"`
+	WriteConcern   string        `yaml:"writeconcern"` // "majority" or a number of nodes, at least 1
+	ConnectTimeout time.Duration `yaml:"connecttimeout"`
+	ServerTimeout  time.Duration `yaml:"servertimeout"`
+	SocketTimeout  time.Duration `yaml:"sockettimeout"`
+}
+
+// clientOptions builds the driver options. Without a URI it falls back to
+// the dbhost and dbport keys.
+func (c *Config) clientOptions() (*options.ClientOptions, error) {
+	m := c.Mongo
+	uri := m.URI
+	if uri == "" {
+		uri = fmt.Sprintf("mongodb://%s%s", c.DbHost, c.DbPort)
+	}
+	opts := options.Client().ApplyURI(uri).SetMonitor(otelmongo.NewMonitor())
+	if m.Username != "" {
+		opts.SetAuth(options.Credential{
+			Username:      m.Username,
+			Password:      m.Password,
+			AuthSource:    m.AuthSource,
+			AuthMechanism: m.AuthMechanism,
+		})
+	}
+	if m.TLSCAFile != "" || m.TLSCertFile != "" {
+		tlsConfig, err := m.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if m.ReplicaSet != "" {
+		opts.SetReplicaSet(m.ReplicaSet)
+	}
+	if m.MaxPoolSize != 0 {
+		opts.SetMaxPoolSize(m.MaxPoolSize)
+	}
+	if m.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(m.ReadPreference)
+		if err != nil {
+			return nil, fmt.Errorf("%w: readpreference: %v", ErrInvalidMongoConfig, err)
+		}
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, fmt.Errorf("%w: readpreference: %v", ErrInvalidMongoConfig, err)
+		}
+		opts.SetReadPreference(rp)
+	}
+	if m.WriteConcern != "" {
+		wc, err := parseWriteConcern(m.WriteConcern)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetWriteConcern(wc)
+	}
+	if m.ConnectTimeout != 0 {
+		opts.SetConnectTimeout(m.ConnectTimeout)
+	}
+	if m.ServerTimeout != 0 {
+		opts.SetServerSelectionTimeout(m.ServerTimeout)
+	}
+	if m.SocketTimeout != 0 {
+		opts.SetSocketTimeout(m.SocketTimeout)
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMongoConfig, err)
+	}
+	// conditional updates need the matched count of acknowledged writes
+	if opts.WriteConcern != nil && !opts.WriteConcern.Acknowledged() {
+		return nil, fmt.Errorf("%w: unacknowledged writes aren't supported", ErrInvalidMongoConfig)
+	}
+	return opts, nil
+}
+
+func (m *MongoConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if m.TLSCAFile != "" {
+		ca, err := os.ReadFile(m.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrInvalidMongoConfig, m.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if m.TLSCertFile != "" {
+		keyFile := m.TLSKeyFile
+		if keyFile == "" {
+			keyFile = m.TLSCertFile
+		}
+		cert, err := tls.LoadX509KeyPair(m.TLSCertFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func parseWriteConcern(value string) (*writeconcern.WriteConcern, error) {
+	if value == "majority" {
+		return writeconcern.Majority(), nil
+	}
+	w, err := strconv.Atoi(value)
+	if err != nil || w < 1 {
+		return nil, fmt.Errorf("%w: writeconcern must be \"majority\" or a number of at least 1", ErrInvalidMongoConfig)
+	}
+	return &writeconcern.WriteConcern{W: w}, nil
+}
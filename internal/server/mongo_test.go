@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWriteConcern(t *testing.T) {
+	for _, tt := range []struct {
+		uri, writeConcern string
+		valid             bool
+	}{
+		{"mongodb://localhost", "", true},
+		{"mongodb://localhost", "majority", true},
+		{"mongodb://localhost", "1", true},
+		{"mongodb://localhost", "3", true},
+		{"mongodb://localhost", "0", false},
+		{"mongodb://localhost", "-1", false},
+		{"mongodb://localhost", "all", false},
+		{"mongodb://localhost/?w=0", "", false},
+		{"mongodb://localhost/?w=0", "majority", true},
+		{"mongodb://localhost/?w=majority", "", true},
+	} {
+		config := &Config{Mongo: MongoConfig{URI: tt.uri, WriteConcern: tt.writeConcern}}
+		_, err := config.clientOptions()
+		if tt.valid && err != nil {
+			t.Errorf("%s, writeconcern %q: %v", tt.uri, tt.writeConcern, err)
+		} else if !tt.valid && !errors.Is(err, ErrInvalidMongoConfig) {
+			t.Errorf("%s, writeconcern %q: got %v, want %v", tt.uri, tt.writeConcern, err, ErrInvalidMongoConfig)
+		}
+	}
+}
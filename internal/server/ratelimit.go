@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"gomongojwt/internal/metrics"
+	"gomongojwt/internal/ratelimit"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/repository/memory"
+	"gomongojwt/internal/service"
+	"gomongojwt/internal/util/resperr"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// openLimits returns the repository the rate limits are kept in. The mongo
+// store shares them between instances and needs the mongo storage driver.
+func openLimits(store repository.Repositories, config ratelimit.Config) (repository.LimitRepository, error) {
+	switch config.Store {
+	case "", ratelimit.StoreMemory:
+		return memory.NewLimitRep(), nil
+	case ratelimit.StoreMongo:
+		if limits, ok := store.(repository.LimitStore); ok {
+			return limits.Limit(), nil
+		}
+		return nil, fmt.Errorf("the %s rate limit store needs the %s storage driver", ratelimit.StoreMongo, DriverMongo)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.Store)
+	}
+}
+
+// limitIP throttles the requests of every client IP and rejects the locked
+// out ones.
+func (s *server) limitIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.allow(w, r, ratelimit.IPKey(s.proxies.ClientIP(r)), s.config.RateLimit.IP) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allow takes a token for key and otherwise answers 429 with a Retry-After
+// header.
+func (s *server) allow(w http.ResponseWriter, r *http.Request, key string, rule ratelimit.Rule) bool {
+	if s.limiter == nil {
+		return true
+	}
+	wait, err := s.limiter.Allow(r.Context(), key, rule)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ratelimit.ErrLockedOut):
+		s.respondLimited(w, r, wait, "lockout", resperr.ErrLockedOut)
+	case errors.Is(err, ratelimit.ErrRateLimited), errors.Is(err, repository.ErrLimitConflict):
+		s.respondLimited(w, r, wait, "rate", resperr.ErrTooManyRequests)
+	default:
+		s.respondInternal(w, r, err)
+	}
+	return false
+}
+func (s *server) respondLimited(w http.ResponseWriter, r *http.Request, wait time.Duration, reason string, err error) {
+	metrics.RateLimited.WithLabelValues(reason).Inc()
+	w.Header().Set("Retry-After", retryAfter(wait))
+	s.respond(w, r, http.StatusTooManyRequests, nil, err)
+}
+
+// retryAfter rounds wait up to whole seconds, at least one.
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+// fail counts a failed attempt against each key; empty keys are skipped. The
+// request has failed already, so errors are only logged.
+func (s *server) fail(r *http.Request, keys ...string) {
+	if s.limiter == nil {
+		return
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.limiter.Fail(r.Context(), key); err != nil {
+			s.logger.LogAttrs(r.Context(), slog.LevelError, "Counting failure failed", slog.String("key", key), slog.String("Error", err.Error()))
+		}
+	}
+}
+
+// succeed forgets the failures of key. The IP key is never reset this way,
+// or one valid account would let a client clear its lockout between guesses
+// at other logins.
+func (s *server) succeed(r *http.Request, key string) {
+	if s.limiter == nil || key == "" {
+		return
+	}
+	if err := s.limiter.Succeed(r.Context(), key); err != nil {
+		s.logger.LogAttrs(r.Context(), slog.LevelError, "Resetting failures failed", slog.String("key", key), slog.String("Error", err.Error()))
+	}
+}
+
+// limitUser throttles the user a token pair presented for refresh belongs to
+// and returns their key, which is empty if the access token isn't valid. The
+// signature is checked, so nobody can exhaust the limits of another user.
+func (s *server) limitUser(w http.ResponseWriter, r *http.Request, access string) (string, bool) {
+	if s.limiter == nil {
+		return "", true
+	}
+	claims, err := s.tokens.ValidateJWTForRefresh(r.Context(), access, s.config.RefreshGrace)
+	if err != nil {
+		return "", true
+	}
+	user := ratelimit.UserKey(claims.User)
+	return user, s.allow(w, r, user, s.config.RateLimit.User)
+}
+
+// guessed reports whether a refresh or logout failed because the refresh
+// token was wrong. Invalid access tokens aren't counted: honest clients
+// present expired ones, or ones signed by a key that was rotated out.
+func guessed(err error) bool {
+	return errors.Is(err, service.ErrRefreshMismatch) || errors.Is(err, service.ErrRefreshReused)
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		wait time.Duration
+		want string
+	}{
+		{0, "1"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{time.Second + time.Millisecond, "2"},
+		{15 * time.Minute, "900"},
+	} {
+		if got := retryAfter(tt.wait); got != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.wait, got, tt.want)
+		}
+	}
+}
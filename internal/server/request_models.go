@@ -1,6 +1,36 @@
 package server
 
+import "gomongojwt/internal/models"
+
 type TokenPair struct {
 	Access  string `json:"access"`
 	Refresh string `json:"refresh"`
 }
+
+type Credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type CreateUser struct {
+	Name     string `json:"name"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+}
+
+// UpdateUser only changes the fields present in the body.
+type UpdateUser struct {
+	Name     *string `json:"name,omitempty"`
+	Login    *string `json:"login,omitempty"`
+	Password *string `json:"password,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+	Admin    *bool   `json:"admin,omitempty"`
+}
+
+type UserList struct {
+	Users []models.User `json:"users"`
+	Total int64         `json:"total"`
+	Page  int64         `json:"page"`
+	Limit int64         `json:"limit"`
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/util"
+	"os"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures is the content of a seed file. JSON files work as well, since
+// JSON is a subset of YAML.
+type Fixtures struct {
+	Users []UserFixture `yaml:"users"`
+}
+
+type UserFixture struct {
+	Name     string `yaml:"name"`
+	Login    string `yaml:"login"`
+	Password string `yaml:"password" validate:"required,min=8"`
+	Admin    bool   `yaml:"admin"`
+	Disabled bool   `yaml:"disabled"`
+}
+
+// Seed loads the fixtures in path into the configured storage. Users are matched by
+// login, so seeding the same file twice leaves the data as it was after the
+// first run.
+func Seed(config *Config, path string) error {
+	fixtures, err := loadFixtures(path)
+	if err != nil {
+		return err
+	}
+	if config.StorageDriver() == DriverMemory {
+		return fmt.Errorf("the %s driver loads %s on start and can't be seeded", DriverMemory, config.SeedFile)
+	}
+	ctx := context.Background()
+	store, closeStore, err := openStore(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer closeStore(ctx)
+	if err = seedFixtures(ctx, store.User(), fixtures); err != nil {
+		return err
+	}
+	fmt.Printf("Seeded %d users from %s\n", len(fixtures.Users), path)
+	return nil
+}
+
+func loadFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixtures := &Fixtures{}
+	if err = yaml.Unmarshal(data, fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+func seedFixtures(ctx context.Context, users repository.UserRepository, fixtures *Fixtures) error {
+	validate := validator.New()
+	for _, fixture := range fixtures.Users {
+		if err := seedUser(ctx, users, validate, fixture); err != nil {
+			return fmt.Errorf("user %q: %w", fixture.Login, err)
+		}
+	}
+	return nil
+}
+
+// seedUser creates the user or brings an existing one in line with the
+// fixture. The password is only rehashed if it no longer matches.
+func seedUser(ctx context.Context, users repository.UserRepository, validate *validator.Validate, fixture UserFixture) error {
+	if err := validate.Struct(fixture); err != nil {
+		return err
+	}
+	usr, err := users.FindByLogin(ctx, fixture.Login)
+	exists := err == nil
+	if errors.Is(err, repository.ErrUserNotFound) {
+		usr = &models.User{GUID: primitive.NewObjectID(), Login: fixture.Login}
+	} else if err != nil {
+		return err
+	}
+	usr.Name = fixture.Name
+	usr.Admin = fixture.Admin
+	usr.Disabled = fixture.Disabled
+	if err = validate.Struct(usr); err != nil {
+		return err
+	}
+	if ok, _ := util.VerifyPassword(fixture.Password, usr.PasswordHash); !ok {
+		if usr.PasswordHash, err = util.HashPassword(fixture.Password); err != nil {
+			return err
+		}
+	}
+	if exists {
+		return users.Update(ctx, usr)
+	}
+	return users.Create(ctx, usr)
+}
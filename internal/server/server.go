@@ -2,24 +2,37 @@ package server
 
 import (
 	"context"
-	"fmt"
-	"gomongojwt/internal/models"
-	"gomongojwt/internal/repository"
+	"gomongojwt/internal/metrics"
+	"gomongojwt/internal/ratelimit"
 	"gomongojwt/internal/service"
+	"gomongojwt/internal/tracing"
+	"gomongojwt/internal/util"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/exp/slog"
 )
 
 func connectDB(ctx context.Context, config *Config) (*mongo.Client, error) {
-	connectionString := fmt.Sprintf("mongodb://%s%s", config.DbHost, config.DbPort)
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	opts, err := config.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	timeout := 3 * time.Second
+	for _, t := range []time.Duration{config.Mongo.ConnectTimeout, config.Mongo.ServerTimeout} {
+		if t > timeout {
+			timeout = t
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(connectionString))
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -27,45 +40,157 @@ func connectDB(ctx context.Context, config *Config) (*mongo.Client, error) {
 	if err = client.Ping(ctx, nil); err != nil {
 		return nil, err
 	}
-	fmt.Printf("Connected to DB on URI: %s\n", connectionString)
 	return client, nil
 }
 
-func seedUsers(db *mongo.Database, collectionName string) {
-	db.Collection(collectionName).InsertMany(context.Background(), []interface{}{
-		models.User{GUID: primitive.NewObjectIDFromTimestamp(time.Now()), Name: "Bonnie"},
-		models.User{GUID: primitive.NewObjectIDFromTimestamp(time.Now().Add(2 * time.Minute)), Name: "Clyde"},
-	}, nil)
-}
-
+// StartServer serves until SIGINT or SIGTERM, then shuts down in order:
+// /readyz starts failing for config.ShutdownDelay, the listener stops and in-flight requests get config.DrainTimeout to finish,
+// background jobs are stopped and waited for, the storage is closed and pending spans are flushed last.
+// A second signal during shutdown kills the process.
 func StartServer(config *Config) error {
-	ctx := context.Background()
-	client, err := connectDB(ctx, config)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := initServer(config)
+
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		if err = client.Disconnect(ctx); err != nil {
-			panic(err)
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			server.logger.LogAttrs(ctx, slog.LevelError, "Flushing traces failed", slog.String("Error", err.Error()))
 		}
 	}()
-
-	server := initServer(config)
-	server.client = client
-
-	db := server.client.Database(config.Database, nil)
-	if err := db.Collection(config.Collection).Drop(ctx); err != nil {
+	store, closeStore, err := openStore(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeStore(context.Background()); err != nil {
+			server.logger.LogAttrs(ctx, slog.LevelError, "Closing storage failed", slog.String("Error", err.Error()))
+		}
+	}()
+	server.logger.LogAttrs(ctx, slog.LevelInfo, "Storage opened", storageAttrs(config)...)
+	server.store = store
+	keys, err := openKeystore(ctx, config, store)
+	if err != nil {
+		return err
+	}
+	server.keys = keys
+	tokens := &util.Tokens{
+		Keys:     keys,
+		Issuer:   config.Issuer,
+		Audience: config.Audience,
+		Leeway:   config.Leeway,
+		TTL:      config.AccessTTL,
+	}
+	server.tokens = tokens
+	if server.proxies, err = ratelimit.ParseProxies(config.RateLimit.TrustedProxies); err != nil {
 		return err
 	}
-	store := repository.CreateStore(db)
-	server.service = service.InitService(store, db)
-	seedUsers(db, config.Collection)
+	if config.RateLimit.Enabled {
+		limits, err := openLimits(store, config.RateLimit)
+		if err != nil {
+			return err
+		}
+		server.limiter = ratelimit.New(limits, config.RateLimit.Lockout)
+	}
+	serv := service.InitService(store, tokens, config.RefreshGrace)
+	if err := serv.LoadRevocations(ctx); err != nil {
+		return err
+	}
+	server.service = serv
+	if err := metrics.RegisterActiveSessions(func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), readinessCheckTimeout)
+		defer cancel()
+		count, err := serv.ActiveSessions(ctx)
+		if err != nil {
+			server.logger.LogAttrs(ctx, slog.LevelError, "Counting active sessions failed", slog.String("Error", err.Error()))
+			return math.NaN()
+		}
+		return float64(count)
+	}); err != nil {
+		return err
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	defer func() {
+		stopJobs()
+		jobs.Wait()
+		server.logger.LogAttrs(ctx, slog.LevelInfo, "Background jobs stopped")
+	}()
+	runJob := func(job func(context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(jobsCtx)
+		}()
+	}
+	runJob(func(ctx context.Context) {
+		keys.Run(ctx, config.KeyRotation, config.keySync(), func(err error) {
+			server.logger.LogAttrs(ctx, slog.LevelError, "Key rotation failed", slog.String("Error", err.Error()))
+		})
+	})
+	runJob(server.reloadKeysOnHangup)
+	runJob(func(ctx context.Context) {
+		serv.SyncRevocations(ctx, config.RevocationSync, func(err error) {
+			server.logger.LogAttrs(ctx, slog.LevelError, "Revocation sync failed", slog.String("Error", err.Error()))
+		})
+	})
 
+	httpServer := &http.Server{
+		Addr:              config.Port,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- httpServer.ListenAndServe()
+	}()
 	server.logger.LogAttrs(ctx, slog.LevelInfo,
 		"Server started",
 		slog.Time("at", time.Now()),
 		slog.String("port", config.Port),
 	)
 
-	return http.ListenAndServe(config.Port, server)
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	server.draining.Store(true)
+	server.logger.LogAttrs(ctx, slog.LevelInfo, "Shutting down", slog.String("drain timeout", config.DrainTimeout.String()))
+	// give load balancers time to see /readyz fail before the listener closes
+	time.Sleep(config.ShutdownDelay)
+	drainCtx, cancel := context.WithTimeout(context.Background(), config.DrainTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(drainCtx); err != nil {
+		server.logger.LogAttrs(ctx, slog.LevelWarn, "Drain timed out, closing remaining connections", slog.String("Error", err.Error()))
+		httpServer.Close()
+	}
+	server.logger.LogAttrs(ctx, slog.LevelInfo, "Listener stopped")
+	return nil
+}
+
+// reloadKeysOnHangup re-reads the keystore from disk on SIGHUP.
+func (s *server) reloadKeysOnHangup(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := s.keys.Reload(ctx); err != nil {
+				s.logger.LogAttrs(ctx, slog.LevelError, "Key reload failed", slog.String("Error", err.Error()))
+				continue
+			}
+			s.logger.LogAttrs(ctx, slog.LevelInfo, "Keys reloaded", slog.Time("at", time.Now()))
+		}
+	}
 }
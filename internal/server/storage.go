@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/repository/memory"
+	"gomongojwt/internal/repository/sqlite"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DriverMongo  = "mongo"
+	DriverSQLite = "sqlite"
+	DriverMemory = "memory"
+)
+
+type StorageConfig struct {
+	// mongo, sqlite or memory
+	Driver string `yaml:"driver"`
+	// database file of the sqlite driver
+	Path string `yaml:"path"`
+}
+
+// openStore opens the storage backend selected by the config. The returned
+// function releases it.
+func openStore(ctx context.Context, config *Config) (repository.Repositories, func(context.Context) error, error) {
+	switch driver := config.StorageDriver(); driver {
+	case DriverMongo:
+		store, client, err := openMongoStore(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, client.Disconnect, nil
+	case DriverSQLite:
+		store, err := openSQLiteStore(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func(context.Context) error { return store.Close() }, nil
+	case DriverMemory:
+		store, err := openDevStore(ctx, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func(context.Context) error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// openMongoStore connects to the database and prepares its indexes.
+func openMongoStore(ctx context.Context, config *Config) (*repository.Store, *mongo.Client, error) {
+	client, err := connectDB(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := repository.CreateStore(client.Database(config.Database, nil), config.Repository())
+	if err = store.EnsureIndexes(ctx); err != nil {
+		client.Disconnect(ctx)
+		return nil, nil, err
+	}
+	return store, client, nil
+}
+
+// openSQLiteStore opens the database file and migrates it to the latest
+// schema.
+func openSQLiteStore(ctx context.Context, config *Config) (*sqlite.Store, error) {
+	if dir := filepath.Dir(config.Storage.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	store, err := sqlite.Open(ctx, config.Storage.Path)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// openDevStore returns an in-memory store holding the fixtures of
+// config.SeedFile.
+func openDevStore(ctx context.Context, config *Config) (*memory.Store, error) {
+	store := memory.NewStore()
+	fixtures, err := loadFixtures(config.SeedFile)
+	if err != nil {
+		return nil, err
+	}
+	if err = seedFixtures(ctx, store.User(), fixtures); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// storageAttrs describes the opened storage for the start-up log.
+func storageAttrs(config *Config) []slog.Attr {
+	attrs := []slog.Attr{slog.String("driver", config.StorageDriver())}
+	switch config.StorageDriver() {
+	case DriverMongo:
+		if opts, err := config.clientOptions(); err == nil {
+			attrs = append(attrs, slog.String("hosts", strings.Join(opts.Hosts, ", ")))
+		}
+	case DriverSQLite:
+		attrs = append(attrs, slog.String("path", config.Storage.Path))
+	case DriverMemory:
+		attrs = append(attrs, slog.String("seedfile", config.SeedFile))
+	}
+	return attrs
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"gomongojwt/internal/metrics"
+	"gomongojwt/internal/util"
+)
+
+// failureReason returns the label of the first reason err wraps, "error" for
+// unexpected errors and "" for nil.
+func failureReason(err error, reasons []errorReason) string {
+	if err == nil {
+		return ""
+	}
+	for _, r := range reasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return "error"
+}
+
+type errorReason struct {
+	err    error
+	reason string
+}
+
+// unknown logins wrap ErrInvalidCredentials too, so they are matched first
+var loginReasons = []errorReason{
+	{ErrUserNotFound, "unknown_user"},
+	{ErrInvalidCredentials, "invalid_credentials"},
+	{ErrUserDisabled, "user_disabled"},
+}
+
+var refreshReasons = []errorReason{
+	{util.ErrInvalidSignature, "invalid_signature"},
+	{util.ErrRefreshExpired, "expired"},
+	{ErrInvalidAccess, "invalid_token"},
+	{ErrRefreshMismatch, "mismatch"},
+	{ErrRefreshReused, "reused"},
+	{ErrRefreshConflict, "conflict"},
+	{ErrSessionRevoked, "session_revoked"},
+	{ErrSessionNotFound, "unknown_session"},
+	{ErrUserNotFound, "unknown_user"},
+	{ErrUserDisabled, "user_disabled"},
+}
+
+func countLogin(err error) {
+	reason := failureReason(err, loginReasons)
+	metrics.Logins.WithLabelValues(metrics.Result(reason), reason).Inc()
+}
+func countRefresh(err error) {
+	reason := failureReason(err, refreshReasons)
+	metrics.Refreshes.WithLabelValues(metrics.Result(reason), reason).Inc()
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"sync"
+	"time"
+)
+
+// revocationCache is an in-process copy of the access token denylist. Tokens
+// revoked by this instance are added immediately, the rest arrive with the
+// periodic sync from the repository.
+type revocationCache struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+	repo    repository.RevocationRepository
+}
+
+func newRevocationCache(repo repository.RevocationRepository) *revocationCache {
+	return &revocationCache{
+		revoked: map[string]time.Time{},
+		repo:    repo,
+	}
+}
+
+func (c *revocationCache) IsRevoked(jti string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.revoked[jti]
+	return ok
+}
+
+func (c *revocationCache) Revoke(ctx context.Context, token *models.RevokedToken) error {
+	if err := c.repo.Revoke(ctx, token); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.revoked[token.ID] = token.ExpiresAt
+	c.mu.Unlock()
+	return nil
+}
+
+// Sync adds the active entries from the repository to the cache and drops
+// the expired ones. Entries are never replaced wholesale, so a token revoked
+// while the repository was being read stays revoked.
+func (c *revocationCache) Sync(ctx context.Context) error {
+	tokens, err := c.repo.Active(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, token := range tokens {
+		c.revoked[token.ID] = token.ExpiresAt
+	}
+	for jti, expiresAt := range c.revoked {
+		if !expiresAt.After(now) {
+			delete(c.revoked, jti)
+		}
+	}
+	return nil
+}
+
+// Run syncs the cache every interval until ctx is done. A sync may take at
+// most one interval. An interval of zero or less disables syncing.
+func (c *revocationCache) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			syncCtx, cancel := context.WithTimeout(ctx, interval)
+			err := c.Sync(syncCtx)
+			cancel()
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
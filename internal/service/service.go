@@ -1,66 +1,319 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"gomongojwt/internal/models"
 	"gomongojwt/internal/repository"
+	"gomongojwt/internal/tracing"
 	"gomongojwt/internal/util"
+	"time"
 
-	"go.mongodb.org/mongo-driver/mongo"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrInvalidAccess      = errors.New("invalid access token")
+	ErrRefreshMismatch    = errors.New("refresh tokens don't match")
+	ErrRefreshReused      = errors.New("refresh token reuse detected")
+	ErrSessionRevoked     = errors.New("session is revoked")
+	ErrSessionNotFound    = repository.ErrSessionNotFound
+	ErrTokenRevoked       = errors.New("access token is revoked")
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrUserDisabled       = errors.New("user is disabled")
+	ErrUserNotFound       = repository.ErrUserNotFound
+	ErrRefreshConflict    = repository.ErrRefreshConflict
 )
 
 type Service interface {
-	RefreshTokens(oldAccess, oldRefresh string) (newAccess, newRefresh string, err error)
-	AuthorizeUser(guid string) (access, refresh string, err error)
+	RefreshTokens(ctx context.Context, oldAccess, oldRefresh string, client ClientInfo) (newAccess, newRefresh string, err error)
+	AuthorizeUser(ctx context.Context, login, password string, client ClientInfo) (access, refresh string, err error)
+	Authenticate(ctx context.Context, access string) (*util.JWTpayload, error)
+	Logout(ctx context.Context, access, refresh string, client ClientInfo) error
+	LogoutAll(ctx context.Context, guid string) error
+	Sessions(ctx context.Context, guid string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, guid, id string) error
+	CreateUser(ctx context.Context, input NewUser) (*models.User, error)
+	ListUsers(ctx context.Context, filter repository.UserFilter) ([]models.User, int64, error)
+	GetUser(ctx context.Context, guid string) (*models.User, error)
+	UpdateUser(ctx context.Context, guid string, update UserUpdate) (*models.User, error)
+	DeleteUser(ctx context.Context, guid string) error
+}
+
+// ClientInfo describes the device a session is opened from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
 }
 
 type ServiceInstance struct {
-	store *repository.Store
-	db    *mongo.Database
+	store        repository.Repositories
+	tokens       *util.Tokens
+	refreshGrace time.Duration
+	revocations  *revocationCache
+	validate     *validator.Validate
 }
 
-func InitService(store *repository.Store, db *mongo.Database) *ServiceInstance {
+// InitService works with any storage backend, see repository.Store and
+// memory.Store.
+func InitService(store repository.Repositories, tokens *util.Tokens, refreshGrace time.Duration) *ServiceInstance {
 	serv := &ServiceInstance{
-		store: store,
-		db:    db,
+		store:        store,
+		tokens:       tokens,
+		refreshGrace: refreshGrace,
+		revocations:  newRevocationCache(store.Revocation()),
+		validate:     validator.New(),
 	}
 	return serv
 }
-func (s *ServiceInstance) Store() *repository.Store {
+func (s *ServiceInstance) Store() repository.Repositories {
 	return s.store
 }
-func (s *ServiceInstance) DB() *mongo.Database {
-	return s.db
+
+// ActiveSessions counts the sessions that can still be refreshed: not revoked
+// and used within the access token lifetime plus the refresh grace period.
+func (s *ServiceInstance) ActiveSessions(ctx context.Context) (int64, error) {
+	return s.store.Session().CountActive(ctx, s.activeSince())
+}
+
+// activeSince is when a session must have been used last to still be
+// refreshable.
+func (s *ServiceInstance) activeSince() time.Time {
+	return time.Now().Add(-s.tokens.TTL - s.refreshGrace)
+}
+
+// LoadRevocations loads the access token denylist into memory.
+func (s *ServiceInstance) LoadRevocations(ctx context.Context) error {
+	return s.revocations.Sync(ctx)
+}
+
+// SyncRevocations keeps the in-process denylist in sync with the repository
+// until ctx is done. Syncing is disabled if interval is not positive.
+func (s *ServiceInstance) SyncRevocations(ctx context.Context, interval time.Duration, onError func(error)) {
+	s.revocations.Run(ctx, interval, onError)
 }
 
-func (s *ServiceInstance) RefreshTokens(oldAccess, oldRefresh string) (newAccess, newRefresh string, err error) {
-	guid, err := util.ValidateJWT(oldAccess)
+// RefreshTokens rotates the refresh token of the session the access token was
+// issued for. If the same token is refreshed concurrently, only one request
+// succeeds; the others get ErrRefreshConflict.
+func (s *ServiceInstance) RefreshTokens(ctx context.Context, oldAccess, oldRefresh string, client ClientInfo) (newAccess, newRefresh string, err error) {
+	ctx, span := tracing.Start(ctx, "service.RefreshTokens")
+	defer func() {
+		countRefresh(err)
+		tracing.End(span, err)
+	}()
+	claims, session, err := s.checkRefresh(ctx, oldAccess, oldRefresh, client)
 	if err != nil {
 		return "", "", err
 	}
-	same, err := s.store.User().CompareRefreshAndHash(oldRefresh, guid.User)
+	span.SetAttributes(
+		attribute.String("enduser.id", claims.User),
+		attribute.String("session.id", claims.Session),
+		attribute.Int("session.generation", session.Generation),
+	)
+	if err = s.checkUser(ctx, claims.User); err != nil {
+		return "", "", err
+	}
+	newClaims, err := s.tokens.NewJWTpayload(claims.User, claims.Session)
 	if err != nil {
 		return "", "", err
-	} else if !same {
-		return "", "", errors.New("refresh tokens don't match")
 	}
-	newAccess, newRefresh, err = util.GetTokenPair(guid.User)
+	newAccess, newRefresh, err = s.tokens.GetTokenPair(ctx, newClaims, session.Generation+1)
 	if err != nil {
 		return "", "", err
 	}
-	if err = s.store.User().UpdateRefresh(guid.User, newRefresh); err != nil {
+	// a session only remembers its latest access token, so the one being
+	// replaced is denied now rather than outliving a later logout; this
+	// happens first so a failure leaves the old pair usable for a retry
+	if err = s.revokeAccess(ctx, session); err != nil {
+		return "", "", err
+	}
+	if err = s.store.Session().Rotate(ctx, session, newRefresh, accessToken(newClaims), client.UserAgent, client.IP); err != nil {
 		return "", "", err
 	}
 	return newAccess, newRefresh, nil
 }
 
-func (s *ServiceInstance) AuthorizeUser(guid string) (access, refresh string, err error) {
-	access, refresh, err = util.GetTokenPair(guid)
+// checkRefresh verifies a token pair against its session. Presenting an
+// already rotated refresh token is treated as a leak: the whole token family
+// is revoked and a security event is recorded.
+func (s *ServiceInstance) checkRefresh(ctx context.Context, access, refresh string, client ClientInfo) (*util.JWTpayload, *models.Session, error) {
+	claims, err := s.tokens.ValidateJWTForRefresh(ctx, access, s.refreshGrace)
 	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidAccess, err)
+	}
+	sid, generation, err := util.ParseRefresh(refresh)
+	if err != nil || sid != claims.Session {
+		return nil, nil, ErrRefreshMismatch
+	}
+	session, same, err := s.store.Session().CompareRefreshAndHash(ctx, refresh, sid, claims.User, generation)
+	if err != nil {
+		return nil, nil, err
+	} else if !same {
+		return nil, nil, ErrRefreshMismatch
+	}
+	if session.Revoked {
+		return nil, nil, ErrSessionRevoked
+	}
+	if generation != session.Generation {
+		// finish revoking the family even if the client goes away
+		ctx := context.WithoutCancel(ctx)
+		if err = s.revokeSession(ctx, sid, claims.User); err != nil {
+			return nil, nil, err
+		}
+		if err = s.recordEvent(ctx, models.EventRefreshReuse, session, client); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshReused
+	}
+	return claims, session, nil
+}
+
+// AuthorizeUser opens a new session for an existing, enabled user with the
+// given credentials. It never creates users. Unknown logins cost the same
+// password check as wrong passwords, and both wrap ErrInvalidCredentials;
+// unknown logins additionally wrap ErrUserNotFound.
+func (s *ServiceInstance) AuthorizeUser(ctx context.Context, login, password string, client ClientInfo) (access, refresh string, err error) {
+	ctx, span := tracing.Start(ctx, "service.AuthorizeUser")
+	defer func() {
+		countLogin(err)
+		tracing.End(span, err)
+	}()
+	usr, err := s.store.User().FindByLogin(ctx, login)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		util.VerifyPassword(password, "")
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrUserNotFound)
+	} else if err != nil {
 		return "", "", err
 	}
-	err = s.store.User().UpdateRefresh(guid, refresh)
+	ok, err := util.VerifyPassword(password, usr.PasswordHash)
 	if err != nil {
 		return "", "", err
+	} else if !ok {
+		return "", "", ErrInvalidCredentials
+	}
+	if usr.Disabled {
+		return "", "", ErrUserDisabled
+	}
+	guid := usr.GUID.Hex()
+	span.SetAttributes(attribute.String("enduser.id", guid))
+	now := time.Now()
+	session := &models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     usr.GUID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+	}
+	claims, err := s.tokens.NewJWTpayload(guid, session.ID.Hex())
+	if err != nil {
+		return "", "", err
+	}
+	session.Access = accessToken(claims)
+	access, refresh, err = s.tokens.GetTokenPair(ctx, claims, session.Generation)
+	if err != nil {
+		return "", "", err
+	}
+	if err = s.store.Session().Create(ctx, session, refresh); err != nil {
+		return "", "", err
 	}
 	return access, refresh, err
 }
+
+// Authenticate validates the access token and checks it against the
+// revocation list.
+func (s *ServiceInstance) Authenticate(ctx context.Context, access string) (*util.JWTpayload, error) {
+	claims, err := s.tokens.ValidateJWT(ctx, access)
+	if err != nil {
+		return nil, err
+	}
+	if s.revocations.IsRevoked(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Logout revokes the session the token pair belongs to.
+func (s *ServiceInstance) Logout(ctx context.Context, access, refresh string, client ClientInfo) error {
+	claims, _, err := s.checkRefresh(ctx, access, refresh, client)
+	if err != nil {
+		return err
+	}
+	return s.revokeSession(ctx, claims.Session, claims.User)
+}
+
+func (s *ServiceInstance) LogoutAll(ctx context.Context, guid string) error {
+	sessions, err := s.store.Session().RevokeByUser(ctx, guid)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err = s.revokeAccess(ctx, &sessions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sessions lists the sessions of the user that can still be refreshed.
+func (s *ServiceInstance) Sessions(ctx context.Context, guid string) ([]models.Session, error) {
+	return s.store.Session().ListByUser(ctx, guid, s.activeSince())
+}
+
+func (s *ServiceInstance) RevokeSession(ctx context.Context, guid, id string) error {
+	return s.revokeSession(ctx, id, guid)
+}
+
+// checkUser makes sure tokens are only reissued while the user exists and is
+// enabled.
+func (s *ServiceInstance) checkUser(ctx context.Context, guid string) error {
+	usr, err := s.store.User().FindByID(ctx, guid)
+	if err != nil {
+		return err
+	} else if usr.Disabled {
+		return ErrUserDisabled
+	}
+	return nil
+}
+
+// revokeSession revokes the session together with its latest access token.
+func (s *ServiceInstance) revokeSession(ctx context.Context, id, guid string) error {
+	session, err := s.store.Session().Revoke(ctx, id, guid)
+	if err != nil {
+		return err
+	}
+	return s.revokeAccess(ctx, session)
+}
+
+func (s *ServiceInstance) revokeAccess(ctx context.Context, session *models.Session) error {
+	if session.Access.ID == "" || !session.Access.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+	return s.revocations.Revoke(ctx, &models.RevokedToken{
+		ID:        session.Access.ID,
+		ExpiresAt: session.Access.ExpiresAt,
+	})
+}
+
+func accessToken(claims *util.JWTpayload) models.AccessToken {
+	return models.AccessToken{
+		ID:        claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+}
+
+func (s *ServiceInstance) recordEvent(ctx context.Context, eventType string, session *models.Session, client ClientInfo) error {
+	return s.store.Audit().Record(ctx, &models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		Type:      eventType,
+		UserID:    session.UserID,
+		SessionID: session.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		CreatedAt: time.Now(),
+	})
+}
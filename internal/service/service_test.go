@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/repository/memory"
+	"gomongojwt/internal/repository/sqlite"
+	"gomongojwt/internal/util"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const concurrentRefreshes = 8
+
+func testStores(t *testing.T) map[string]repository.Repositories {
+	t.Helper()
+	db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]repository.Repositories{
+		"memory": memory.NewStore(),
+		"sqlite": db,
+	}
+}
+
+// testService returns a service on store with one user, and a token pair
+// of that user.
+func testService(t *testing.T, store repository.Repositories) (serv *ServiceInstance, guid, access, refresh string) {
+	t.Helper()
+	ctx := context.Background()
+	keys, err := util.OpenKeystore(t.TempDir(), util.AlgHS256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := &util.Tokens{Keys: keys, TTL: time.Minute}
+	serv = InitService(store, tokens, time.Hour)
+
+	hash, err := util.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr := &models.User{GUID: primitive.NewObjectID(), Name: "bonnie", Login: "bonnie", PasswordHash: hash}
+	if err = store.User().Create(ctx, usr); err != nil {
+		t.Fatal(err)
+	}
+	access, refresh, err = serv.AuthorizeUser(ctx, "bonnie", "password", ClientInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serv, usr.GUID.Hex(), access, refresh
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			serv, guid, access, refresh := testService(t, store)
+
+			start := make(chan struct{})
+			errs := make([]error, concurrentRefreshes)
+			pairs := make([][2]string, concurrentRefreshes)
+			var wg sync.WaitGroup
+			for i := 0; i < concurrentRefreshes; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					<-start
+					pairs[i][0], pairs[i][1], errs[i] = serv.RefreshTokens(ctx, access, refresh, ClientInfo{})
+				}(i)
+			}
+			close(start)
+			wg.Wait()
+
+			var won [2]string
+			var succeeded, conflicted int
+			for i, err := range errs {
+				switch {
+				case err == nil:
+					succeeded++
+					won = pairs[i]
+				case errors.Is(err, ErrRefreshConflict):
+					conflicted++
+				default:
+					t.Errorf("refresh %d: %v", i, err)
+				}
+			}
+			if succeeded != 1 || conflicted != concurrentRefreshes-1 {
+				t.Fatalf("got %d successes and %d conflicts, want 1 and %d", succeeded, conflicted, concurrentRefreshes-1)
+			}
+
+			if _, _, err := serv.RefreshTokens(ctx, access, refresh, ClientInfo{}); !errors.Is(err, ErrRefreshReused) {
+				t.Fatalf("reusing the rotated refresh token: got %v, want %v", err, ErrRefreshReused)
+			}
+			sessions, err := serv.Sessions(ctx, guid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != 0 {
+				t.Fatalf("session family wasn't revoked, active sessions: %+v", sessions)
+			}
+			if _, _, err = serv.RefreshTokens(ctx, won[0], won[1], ClientInfo{}); !errors.Is(err, ErrSessionRevoked) {
+				t.Fatalf("refreshing the latest pair after reuse: got %v, want %v", err, ErrSessionRevoked)
+			}
+		})
+	}
+}
+
+func TestLogoutAfterRefresh(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			serv, _, access, refresh := testService(t, store)
+			newAccess, newRefresh, err := serv.RefreshTokens(ctx, access, refresh, ClientInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = serv.Authenticate(ctx, access); !errors.Is(err, ErrTokenRevoked) {
+				t.Fatalf("access token replaced by a refresh: got %v, want %v", err, ErrTokenRevoked)
+			}
+			if _, err = serv.Authenticate(ctx, newAccess); err != nil {
+				t.Fatal(err)
+			}
+			if err = serv.Logout(ctx, newAccess, newRefresh, ClientInfo{}); err != nil {
+				t.Fatal(err)
+			}
+			for _, token := range []string{access, newAccess} {
+				if _, err = serv.Authenticate(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+					t.Fatalf("access token after logout: got %v, want %v", err, ErrTokenRevoked)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gomongojwt/internal/models"
+	"gomongojwt/internal/repository"
+	"gomongojwt/internal/util"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidUser = errors.New("invalid user")
+	ErrLoginTaken  = repository.ErrLoginTaken
+)
+
+// NewUser is the input for creating a user.
+type NewUser struct {
+	Name     string `validate:"required,min=3"`
+	Login    string `validate:"required,min=3"`
+	Password string `validate:"required,min=8"`
+	Admin    bool
+}
+
+// UserUpdate changes the fields that are set and leaves the rest as they are.
+type UserUpdate struct {
+	Name     *string
+	Login    *string
+	Password *string
+	Disabled *bool
+	Admin    *bool
+}
+
+func (s *ServiceInstance) CreateUser(ctx context.Context, input NewUser) (*models.User, error) {
+	if err := s.validate.Struct(input); err != nil {
+		return nil, invalidUser(err)
+	}
+	hash, err := util.HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+	usr := &models.User{
+		GUID:         primitive.NewObjectID(),
+		Name:         input.Name,
+		Login:        input.Login,
+		PasswordHash: hash,
+		Admin:        input.Admin,
+	}
+	if err = s.store.User().Create(ctx, usr); err != nil {
+		return nil, err
+	}
+	return usr, nil
+}
+
+func (s *ServiceInstance) ListUsers(ctx context.Context, filter repository.UserFilter) ([]models.User, int64, error) {
+	return s.store.User().List(ctx, filter)
+}
+
+func (s *ServiceInstance) GetUser(ctx context.Context, guid string) (*models.User, error) {
+	return s.store.User().FindByID(ctx, guid)
+}
+
+// UpdateUser applies the update and validates the result. Disabling a user
+// also ends their sessions.
+func (s *ServiceInstance) UpdateUser(ctx context.Context, guid string, update UserUpdate) (*models.User, error) {
+	usr, err := s.store.User().FindByID(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		usr.Name = *update.Name
+	}
+	if update.Login != nil {
+		usr.Login = *update.Login
+	}
+	if update.Disabled != nil {
+		usr.Disabled = *update.Disabled
+	}
+	if update.Admin != nil {
+		usr.Admin = *update.Admin
+	}
+	if err = s.validate.Struct(usr); err != nil {
+		return nil, invalidUser(err)
+	}
+	if update.Password != nil {
+		if err = s.validate.Struct(NewUser{usr.Name, usr.Login, *update.Password, usr.Admin}); err != nil {
+			return nil, invalidUser(err)
+		}
+		if usr.PasswordHash, err = util.HashPassword(*update.Password); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.store.User().Update(ctx, usr); err != nil {
+		return nil, err
+	}
+	if usr.Disabled {
+		if err = s.LogoutAll(ctx, guid); err != nil {
+			return nil, err
+		}
+	}
+	return usr, nil
+}
+
+// DeleteUser ends the sessions of the user and removes them.
+func (s *ServiceInstance) DeleteUser(ctx context.Context, guid string) error {
+	if _, err := s.store.User().FindByID(ctx, guid); err != nil {
+		return err
+	}
+	if err := s.LogoutAll(ctx, guid); err != nil {
+		return err
+	}
+	return s.store.User().Delete(ctx, guid)
+}
+
+// invalidUser wraps ErrInvalidUser with the fields that failed validation,
+// e.g. "invalid user: Name must satisfy min=3".
+func invalidUser(err error) error {
+	var fields validator.ValidationErrors
+	if !errors.As(err, &fields) {
+		return err
+	}
+	failed := make([]string, 0, len(fields))
+	for _, field := range fields {
+		rule := field.Tag()
+		if field.Param() != "" {
+			rule += "=" + field.Param()
+		}
+		failed = append(failed, fmt.Sprintf("%s must satisfy %s", field.Field(), rule))
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidUser, strings.Join(failed, ", "))
+}
@@ -1,81 +1,200 @@
 package util
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"gomongojwt/internal/tracing"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrInvalidSignature = errors.New("jwt signature is invalid")
+	ErrRefreshExpired   = errors.New("jwt is too old to be refreshed")
+	ErrMalformedRefresh = errors.New("malformed refresh token")
 )
 
 type JWTpayload struct {
-	User string `json:"user"`
+	User    string `json:"user"`
+	Session string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(guid string) (string, error) {
-	token := jwt.NewWithClaims(
-		jwt.SigningMethodRS512,
-		&JWTpayload{
-			guid,
-			jwt.RegisteredClaims{
-				IssuedAt:  jwt.NewNumericDate(time.Now()),
-				ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
-				NotBefore: jwt.NewNumericDate(time.Now()),
-			},
+// Tokens signs and validates access tokens with the keys of a keystore and
+// the registered claims this service issues.
+type Tokens struct {
+	Keys     *Keystore
+	Issuer   string
+	Audience []string
+	// allowed clock skew when checking exp, nbf and iat
+	Leeway time.Duration
+	TTL    time.Duration
+}
+
+// NewJWTpayload returns access token claims with a unique jti, so the token
+// can be revoked before it expires.
+func (tk *Tokens) NewJWTpayload(guid, sid string) (*JWTpayload, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &JWTpayload{
+		guid,
+		sid,
+		jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
+			Issuer:    tk.Issuer,
+			Subject:   guid,
+			Audience:  tk.Audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tk.TTL)),
+			NotBefore: jwt.NewNumericDate(now),
 		},
-	)
-	_, priv, err := GetKeyPair()
+	}, nil
+}
+
+func (tk *Tokens) GenerateJWT(ctx context.Context, claims *JWTpayload) (st string, err error) {
+	_, span := tracing.Start(ctx, "util.GenerateJWT")
+	defer func() { tracing.End(span, err) }()
+	key, priv, err := tk.Keys.SigningKey()
 	if err != nil {
 		return "", err
 	}
-	st, err := token.SignedString(priv)
+	span.SetAttributes(attribute.String("jwt.kid", key.ID), attribute.String("jwt.alg", key.Alg))
+	method, err := signingMethod(key.Alg)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	st, err = token.SignedString(priv)
 	if err != nil {
 		return "", err
 	}
 	return st, nil
 }
 
-func ValidateJWT(token string) (*JWTpayload, error) {
-	pub, _, err := GetKeyPair()
+// verificationKey selects the public key by the kid header of the token and
+// rejects tokens whose alg differs from the one the key was generated for.
+func (tk *Tokens) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return tk.Keys.VerificationKey(kid, t.Method.Alg())
+}
+
+// checkIssuerAudience requires the configured issuer and at least one of the
+// configured audiences, if they are set.
+func (tk *Tokens) checkIssuerAudience(claims *JWTpayload) error {
+	if tk.Issuer != "" && claims.Issuer != tk.Issuer {
+		return jwt.ErrTokenInvalidIssuer
+	}
+	if len(tk.Audience) == 0 {
+		return nil
+	}
+	for _, aud := range claims.Audience {
+		for _, expected := range tk.Audience {
+			if aud == expected {
+				return nil
+			}
+		}
+	}
+	return jwt.ErrTokenInvalidAudience
+}
+
+func (tk *Tokens) ValidateJWT(ctx context.Context, token string) (_ *JWTpayload, err error) {
+	_, span := tracing.Start(ctx, "util.ValidateJWT")
+	defer func() { tracing.End(span, err) }()
+	t, err := jwt.ParseWithClaims(token, &JWTpayload{}, tk.verificationKey,
+		jwt.WithValidMethods(SupportedAlgorithms),
+		jwt.WithLeeway(tk.Leeway),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
 		return nil, err
 	}
-	t, err := jwt.ParseWithClaims(token, &JWTpayload{}, func(t *jwt.Token) (interface{}, error) {
-		return pub, nil
-	})
-	if err != nil {
+
+	claims, ok := t.Claims.(*JWTpayload)
+	if !ok || !t.Valid || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid jwt")
+	}
+	if err = tk.checkIssuerAudience(claims); err != nil {
 		return nil, err
 	}
+	return claims, nil
+}
 
-	if claims, ok := t.Claims.(*JWTpayload); ok && t.Valid && claims.ExpiresAt.After(time.Now()) {
-		return claims, nil
+// ValidateJWTForRefresh checks the signature and User claim of an access token
+// presented for refresh. Unlike ValidateJWT it accepts tokens that expired no
+// longer than grace ago.
+func (tk *Tokens) ValidateJWTForRefresh(ctx context.Context, token string, grace time.Duration) (_ *JWTpayload, err error) {
+	_, span := tracing.Start(ctx, "util.ValidateJWTForRefresh")
+	defer func() { tracing.End(span, err) }()
+	t, err := jwt.ParseWithClaims(token, &JWTpayload{}, tk.verificationKey, jwt.WithValidMethods(SupportedAlgorithms), jwt.WithoutClaimsValidation())
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		return nil, ErrInvalidSignature
+	} else if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("invalid jwt")
+
+	claims, ok := t.Claims.(*JWTpayload)
+	if !ok || !t.Valid || claims.User == "" || claims.Session == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid jwt")
+	}
+	if err = tk.checkIssuerAudience(claims); err != nil {
+		return nil, err
+	}
+	if time.Now().After(claims.ExpiresAt.Add(grace)) {
+		return nil, ErrRefreshExpired
+	}
+	return claims, nil
 }
 
-func GenerateRefresh() (string, error) {
+// GenerateRefresh returns a refresh token of the form "sid.generation.secret",
+// so a presented token can be traced back to its family and rotation step.
+func GenerateRefresh(sid string, generation int) (string, error) {
 	bytes := make([]byte, 16)
 	_, err := rand.Read(bytes)
 	if err != nil {
 		return "", err
 	}
-	refresh := base64.StdEncoding.EncodeToString(bytes)
+	refresh := fmt.Sprintf("%s.%d.%s", sid, generation, base64.StdEncoding.EncodeToString(bytes))
 	return refresh, nil
 }
 
-func GetTokenPair(guid string) (access string, refresh string, err error) {
-	access, err = GenerateJWT(guid)
+func ParseRefresh(refresh string) (sid string, generation int, err error) {
+	parts := strings.Split(refresh, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", 0, ErrMalformedRefresh
+	}
+	generation, err = strconv.Atoi(parts[1])
+	if err != nil || generation < 0 {
+		return "", 0, ErrMalformedRefresh
+	}
+	return parts[0], generation, nil
+}
+
+func (tk *Tokens) GetTokenPair(ctx context.Context, claims *JWTpayload, generation int) (access string, refresh string, err error) {
+	access, err = tk.GenerateJWT(ctx, claims)
 	if err != nil {
 		return "", "", err
 	}
-	refresh, err = GenerateRefresh()
+	refresh, err = GenerateRefresh(claims.Session, generation)
 	return access, refresh, err
 }
 
-func GetGUIDFromToken(accessToken string) (string, error) {
-	token, err := ValidateJWT(accessToken)
+func (tk *Tokens) GetGUIDFromToken(ctx context.Context, accessToken string) (string, error) {
+	token, err := tk.ValidateJWT(ctx, accessToken)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DirStorage keeps a keystore in a directory: a manifest and a .pem (and,
+// for asymmetric keys, a .pub) file per key. Versions aren't tracked, so a
+// directory must not be shared between instances.
+type DirStorage struct {
+	dir string
+}
+
+func NewDirStorage(dir string) *DirStorage {
+	return &DirStorage{dir: dir}
+}
+func (d *DirStorage) Load(ctx context.Context) (*KeySet, error) {
+	keys, err := d.manifest()
+	if err != nil {
+		return nil, err
+	}
+	set := &KeySet{Keys: keys, PEM: make(map[string][]byte, len(keys))}
+	for _, key := range keys {
+		if set.PEM[key.ID], err = readKeyFile(d.dir, key.ID); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// Save writes the files of new keys, then the manifest, and removes the files
+// of keys that are no longer listed.
+func (d *DirStorage) Save(ctx context.Context, set *KeySet) error {
+	old, err := d.manifest()
+	if err != nil {
+		return err
+	}
+	for _, key := range set.Keys {
+		if _, err := os.Stat(privateKeyFile(d.dir, key.ID)); err == nil {
+			continue
+		}
+		if err = writeKeyFiles(d.dir, key.ID, set.PEM[key.ID]); err != nil {
+			return err
+		}
+	}
+	if err = d.save(set.Keys); err != nil {
+		return err
+	}
+	set.Version++
+	for _, key := range old {
+		if _, ok := set.PEM[key.ID]; ok {
+			continue
+		}
+		if err = removeKeyPair(d.dir, key.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (d *DirStorage) manifest() ([]KeyInfo, error) {
+	var keys []KeyInfo
+	data, err := os.ReadFile(filepath.Join(d.dir, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrKeyCorrupt, manifestFile, err)
+	}
+	return keys, nil
+}
+
+// save writes the manifest through a temporary file so a crash can't leave
+// it half written.
+func (d *DirStorage) save(keys []KeyInfo) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(d.dir, manifestFile+".tmp")
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.dir, manifestFile))
+}
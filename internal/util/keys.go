@@ -0,0 +1,227 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	BitSize = 4096
+	KeyPath = "internal/util/keys"
+)
+
+const (
+	AlgRS512 = "RS512"
+	AlgPS512 = "PS512"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+)
+
+// SupportedAlgorithms lists the signing algorithms keys can be generated for.
+var SupportedAlgorithms = []string{AlgRS512, AlgPS512, AlgES256, AlgEdDSA, AlgHS256}
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyMissing           = errors.New("key file is missing")
+	ErrKeyCorrupt           = errors.New("key file is corrupt")
+)
+
+const hmacKeyType = "HMAC KEY"
+
+func generatePrivateKey(alg string) (crypto.PrivateKey, error) {
+	switch alg {
+	case AlgRS512, AlgPS512:
+		prk, err := rsa.GenerateKey(rand.Reader, BitSize)
+		if err != nil {
+			return nil, err
+		}
+		if err = prk.Validate(); err != nil {
+			return nil, err
+		}
+		return prk, nil
+	case AlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, prk, err := ed25519.GenerateKey(rand.Reader)
+		return prk, err
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return secret, nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+func generatePublicKey(pub crypto.PublicKey) ([]byte, error) {
+	pbk, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyBytes := ssh.MarshalAuthorizedKey(pbk)
+	return pubKeyBytes, nil
+}
+func encodePrivateKeyToPEM(prk crypto.PrivateKey) ([]byte, error) {
+	if secret, ok := prk.([]byte); ok {
+		return pem.EncodeToMemory(&pem.Block{Type: hmacKeyType, Bytes: secret}), nil
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(prk)
+	if err != nil {
+		return nil, err
+	}
+	privBlock := pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: nil,
+		Bytes:   privDER,
+	}
+	privatePEM := pem.EncodeToMemory(&privBlock)
+	return privatePEM, nil
+}
+func publicKeyFile(dir, kid string) string {
+	return filepath.Join(dir, kid+".pub")
+}
+func privateKeyFile(dir, kid string) string {
+	return filepath.Join(dir, kid+".pem")
+}
+
+// publicOf returns the verification key matching prk. For HMAC it is the
+// secret itself.
+func publicOf(prk crypto.PrivateKey) crypto.PublicKey {
+	if signer, ok := prk.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return prk
+}
+
+// keyID returns the RFC 7638 thumbprint of an asymmetric key and a random id
+// for HMAC secrets, so the id reveals nothing about them.
+func keyID(alg string, prk crypto.PrivateKey) (string, error) {
+	if alg == AlgHS256 {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(id), nil
+	}
+	jwk, err := publicJWK(alg, publicOf(prk))
+	if err != nil {
+		return "", err
+	}
+	return jwk.Kid, nil
+}
+
+// generateKey generates a new key for alg and returns its kid and the PEM
+// encoded private key.
+func generateKey(alg string) (string, []byte, error) {
+	privateKey, err := generatePrivateKey(alg)
+	if err != nil {
+		return "", nil, err
+	}
+	privateKeyBytes, err := encodePrivateKeyToPEM(privateKey)
+	if err != nil {
+		return "", nil, err
+	}
+	kid, err := keyID(alg, privateKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return kid, privateKeyBytes, nil
+}
+
+// writeKeyFiles writes the private key of kid and, for asymmetric keys, its
+// public half in authorized_keys format.
+func writeKeyFiles(dir, kid string, privateKeyBytes []byte) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	pub, _, err := parseKey(kid, privateKeyBytes)
+	if err != nil {
+		return err
+	}
+	if _, hmac := pub.([]byte); !hmac {
+		publicKeyBytes, err := generatePublicKey(pub)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(publicKeyFile(dir, kid), publicKeyBytes, 0666); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(privateKeyFile(dir, kid), privateKeyBytes, 0600)
+}
+func removeKeyPair(dir, kid string) error {
+	if err := os.Remove(publicKeyFile(dir, kid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(privateKeyFile(dir, kid)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// readKeyFile returns the PEM encoded private key of kid.
+func readKeyFile(dir, kid string) ([]byte, error) {
+	path := privateKeyFile(dir, kid)
+	privBytes, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyMissing, path)
+	}
+	return privBytes, err
+}
+
+// parseKey parses a PEM encoded private key; name identifies it in errors.
+// The public half is derived from it rather than stored separately, so the
+// two can't disagree.
+func parseKey(name string, privBytes []byte) (crypto.PublicKey, crypto.PrivateKey, error) {
+	block, _ := pem.Decode(privBytes)
+	if block == nil {
+		return nil, nil, fmt.Errorf("%w: %s: no PEM block", ErrKeyCorrupt, name)
+	}
+	if block.Type == hmacKeyType {
+		if len(block.Bytes) == 0 {
+			return nil, nil, fmt.Errorf("%w: %s: empty secret", ErrKeyCorrupt, name)
+		}
+		return block.Bytes, block.Bytes, nil
+	}
+	priv, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %v", ErrKeyCorrupt, name, err)
+	}
+	return publicOf(priv), priv, nil
+}
+
+// parsePrivateKey accepts PKCS8 and the PKCS1 RSA keys written before other
+// algorithms were supported.
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if priv, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return priv, nil
+	}
+	return x509.ParsePKCS1PrivateKey(der)
+}
+
+// signingMethod returns the jwt signing method for alg.
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	for _, supported := range SupportedAlgorithms {
+		if supported == alg {
+			return jwt.GetSigningMethod(alg), nil
+		}
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
@@ -0,0 +1,359 @@
+package util
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type KeyState string
+
+const (
+	// published in the JWKS ahead of use, so consumers can fetch it in time
+	KeyPending KeyState = "pending"
+	// used to sign new tokens
+	KeyActive KeyState = "active"
+	// only used to verify tokens signed before the last rotation
+	KeyRetired KeyState = "retired"
+)
+
+const manifestFile = "keys.json"
+
+var (
+	ErrUnknownKey  = errors.New("unknown signing key")
+	ErrNoActiveKey = errors.New("keystore has no active key")
+	ErrAlgMismatch = errors.New("token alg doesn't match the signing key")
+	ErrKeysChanged = errors.New("keys were changed by another instance")
+)
+
+type KeyInfo struct {
+	ID          string    `json:"kid"`
+	Alg         string    `json:"alg"`
+	State       KeyState  `json:"state"`
+	CreatedAt   time.Time `json:"created_at"`
+	ActivatedAt time.Time `json:"activated_at,omitempty"`
+	RetiredAt   time.Time `json:"retired_at,omitempty"`
+}
+
+// KeySet is the stored state of a keystore: the manifest and the PEM encoded
+// private key of every key in it, by kid.
+type KeySet struct {
+	Keys    []KeyInfo
+	PEM     map[string][]byte
+	Version int64
+}
+
+// KeyStorage persists a keystore. Save stores set only if the stored one is
+// still at set.Version and then increments it; otherwise it fails with
+// ErrKeysChanged, so instances sharing a storage can't undo each other's
+// rotations.
+type KeyStorage interface {
+	Load(ctx context.Context) (*KeySet, error)
+	Save(ctx context.Context, set *KeySet) error
+}
+
+// keyMaterial is a parsed key pair. For HMAC both halves are the secret.
+type keyMaterial struct {
+	pub  crypto.PublicKey
+	priv crypto.PrivateKey
+}
+
+// Keystore keeps the signing keys in a KeyStorage along with a manifest of
+// their states. Key material is parsed once and held in memory. New keys are
+// generated for alg. Retired keys keep verifying tokens for the overlap
+// period and are removed on the first rotation after it.
+type Keystore struct {
+	// rotation serialises Reload and Rotate, so a reload can't bring back
+	// the keys a concurrent rotation replaced
+	rotation sync.Mutex
+	mu       sync.RWMutex
+	storage  KeyStorage
+	alg      string
+	overlap  time.Duration
+	set      *KeySet
+	material map[string]keyMaterial
+}
+
+// OpenKeystore opens the keystore kept in dir, see NewKeystore.
+func OpenKeystore(dir, alg string, overlap time.Duration) (*Keystore, error) {
+	return NewKeystore(context.Background(), NewDirStorage(dir), alg, overlap)
+}
+
+// NewKeystore loads the keystore from storage. If the keystore is empty or
+// the active key was generated for another algorithm, it rotates until a key
+// for alg is active.
+func NewKeystore(ctx context.Context, storage KeyStorage, alg string, overlap time.Duration) (*Keystore, error) {
+	if _, err := signingMethod(alg); err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		storage: storage,
+		alg:     alg,
+		overlap: overlap,
+	}
+	if err := ks.Reload(ctx); err != nil {
+		return nil, err
+	}
+	// the pending key may have been generated for the old algorithm as well
+	for i := 0; i < 2; i++ {
+		if active, err := ks.Active(); err == nil && active.Alg == alg {
+			break
+		}
+		if err := ks.Rotate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// Reload re-reads the keys from storage. On error the keystore keeps serving
+// the previously loaded keys.
+func (ks *Keystore) Reload(ctx context.Context) error {
+	ks.rotation.Lock()
+	defer ks.rotation.Unlock()
+	_, err := ks.load(ctx)
+	return err
+}
+
+// Rotate activates the pending key, retires the active one and generates a
+// new pending key. Retired keys past the overlap period are dropped.
+func (ks *Keystore) Rotate(ctx context.Context) error {
+	ks.rotation.Lock()
+	defer ks.rotation.Unlock()
+	return ks.rotate(ctx, nil)
+}
+
+// RotateIfDue rotates unless the active key was activated less than interval
+// ago, which it may have been by another instance sharing the storage.
+func (ks *Keystore) RotateIfDue(ctx context.Context, interval time.Duration) error {
+	ks.rotation.Lock()
+	defer ks.rotation.Unlock()
+	return ks.rotate(ctx, func(active KeyInfo) bool {
+		return !time.Now().Before(active.ActivatedAt.Add(interval))
+	})
+}
+
+// load reads and parses the stored keys and swaps them in.
+func (ks *Keystore) load(ctx context.Context) (*KeySet, error) {
+	set, err := ks.storage.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	material := make(map[string]keyMaterial, len(set.Keys))
+	for i := range set.Keys {
+		// manifests written before algorithms were configurable
+		if set.Keys[i].Alg == "" {
+			set.Keys[i].Alg = AlgRS512
+		}
+		kid := set.Keys[i].ID
+		pem, ok := set.PEM[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrKeyMissing, kid)
+		}
+		pub, priv, err := parseKey(kid, pem)
+		if err != nil {
+			return nil, err
+		}
+		material[kid] = keyMaterial{pub, priv}
+	}
+	ks.mu.Lock()
+	ks.set = set
+	ks.material = material
+	ks.mu.Unlock()
+	return set, nil
+}
+
+// rotate rotates the stored keys if due approves of their active key or due
+// is nil. If another instance saved first, its keys are loaded instead.
+func (ks *Keystore) rotate(ctx context.Context, due func(active KeyInfo) bool) error {
+	set, err := ks.load(ctx)
+	if err != nil {
+		return err
+	}
+	if active, err := ks.Active(); err == nil && due != nil && !due(active) {
+		return nil
+	}
+	kid, privBytes, err := generateKey(ks.alg)
+	if err != nil {
+		return err
+	}
+	pub, priv, err := parseKey(kid, privBytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	next := &KeySet{
+		Keys:    make([]KeyInfo, 0, len(set.Keys)+1),
+		PEM:     make(map[string][]byte, len(set.Keys)+1),
+		Version: set.Version,
+	}
+	for _, key := range set.Keys {
+		switch key.State {
+		case KeyPending:
+			key.State = KeyActive
+			key.ActivatedAt = now
+		case KeyActive:
+			key.State = KeyRetired
+			key.RetiredAt = now
+		case KeyRetired:
+			if now.After(key.RetiredAt.Add(ks.overlap)) {
+				continue
+			}
+		}
+		next.Keys = append(next.Keys, key)
+		next.PEM[key.ID] = set.PEM[key.ID]
+	}
+	next.Keys = append(next.Keys, KeyInfo{ID: kid, Alg: ks.alg, State: KeyPending, CreatedAt: now})
+	next.PEM[kid] = privBytes
+	err = ks.storage.Save(ctx, next)
+	if errors.Is(err, ErrKeysChanged) {
+		_, err = ks.load(ctx)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	material := make(map[string]keyMaterial, len(next.Keys))
+	for _, key := range next.Keys {
+		material[key.ID] = ks.material[key.ID]
+	}
+	material[kid] = keyMaterial{pub, priv}
+	ks.set = next
+	ks.material = material
+	return nil
+}
+
+// Run rotates the keys every interval, counted from the activation of the
+// current key, until ctx is done. If sync is positive the keys are also
+// reloaded that often, to pick up rotations of other instances sharing the
+// storage. Non-positive values disable either.
+func (ks *Keystore) Run(ctx context.Context, interval, sync time.Duration, onError func(error)) {
+	if interval <= 0 && sync <= 0 {
+		return
+	}
+	var failed bool
+	for {
+		wait, due := sync, false
+		if interval > 0 {
+			untilDue := interval
+			if active, err := ks.Active(); err == nil {
+				untilDue = time.Until(active.ActivatedAt.Add(interval))
+			}
+			if sync <= 0 || untilDue <= sync {
+				wait, due = untilDue, true
+			}
+		}
+		if failed && wait < time.Minute {
+			wait = time.Minute
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			var err error
+			if due {
+				err = ks.RotateIfDue(ctx, interval)
+			} else {
+				err = ks.Reload(ctx)
+			}
+			failed = err != nil
+			if failed && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (ks *Keystore) active() (KeyInfo, error) {
+	if ks.set == nil {
+		return KeyInfo{}, ErrNoActiveKey
+	}
+	for _, key := range ks.set.Keys {
+		if key.State == KeyActive {
+			return key, nil
+		}
+	}
+	return KeyInfo{}, ErrNoActiveKey
+}
+
+func (ks *Keystore) Active() (KeyInfo, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active()
+}
+
+// Keys returns every key that may be used for verification now or after the
+// next rotation.
+func (ks *Keystore) Keys() []KeyInfo {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.set == nil {
+		return nil
+	}
+	return append([]KeyInfo(nil), ks.set.Keys...)
+}
+
+// SigningKey returns the active key.
+func (ks *Keystore) SigningKey() (KeyInfo, crypto.PrivateKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	active, err := ks.active()
+	if err != nil {
+		return KeyInfo{}, nil, err
+	}
+	return active, ks.material[active.ID].priv, nil
+}
+
+// VerificationKey returns the public key for kid if it is pending, active or
+// retired within the overlap period and was generated for alg. Pending keys
+// are accepted because another instance sharing the storage may have
+// activated them already.
+func (ks *Keystore) VerificationKey(kid, alg string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.set == nil {
+		return nil, ErrUnknownKey
+	}
+	for _, key := range ks.set.Keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.State == KeyRetired && !time.Now().Before(key.RetiredAt.Add(ks.overlap)) {
+			break
+		}
+		if key.Alg != alg {
+			return nil, ErrAlgMismatch
+		}
+		return ks.material[kid].pub, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// PublicKey is a key of the keystore with its public half.
+type PublicKey struct {
+	KeyInfo
+	Public crypto.PublicKey
+}
+
+// PublicKeys returns Keys with their public halves, read at once so a
+// concurrent rotation can't drop a key between the two.
+func (ks *Keystore) PublicKeys() []PublicKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if ks.set == nil {
+		return nil
+	}
+	keys := make([]PublicKey, 0, len(ks.set.Keys))
+	for _, key := range ks.set.Keys {
+		keys = append(keys, PublicKey{KeyInfo: key, Public: ks.material[key.ID].pub})
+	}
+	return keys
+}
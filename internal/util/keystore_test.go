@@ -0,0 +1,251 @@
+package util
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// sharedStorage is a KeyStorage shared by several keystores, like the keys
+// collection shared by instances.
+type sharedStorage struct {
+	mu  sync.Mutex
+	set KeySet
+}
+
+func (s *sharedStorage) Load(ctx context.Context) (*KeySet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set := &KeySet{Keys: append([]KeyInfo(nil), s.set.Keys...), PEM: map[string][]byte{}, Version: s.set.Version}
+	for kid, pem := range s.set.PEM {
+		set.PEM[kid] = pem
+	}
+	return set, nil
+}
+func (s *sharedStorage) Save(ctx context.Context, set *KeySet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if set.Version != s.set.Version {
+		return ErrKeysChanged
+	}
+	set.Version++
+	s.set = *set
+	return nil
+}
+
+func TestSharedKeystoreRotation(t *testing.T) {
+	ctx := context.Background()
+	storage := &sharedStorage{}
+	a, err := NewKeystore(ctx, storage, AlgHS256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeystore(ctx, storage, AlgHS256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keysA, keysB := a.Keys(), b.Keys(); len(keysA) != 2 || keysA[0] != keysB[0] || keysA[1] != keysB[1] {
+		t.Fatalf("instances loaded different keys: %v and %v", keysA, keysB)
+	}
+
+	if err = a.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tokensA := &Tokens{Keys: a, TTL: time.Minute}
+	claims, err := tokensA.NewJWTpayload("user", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := tokensA.GenerateJWT(ctx, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = (&Tokens{Keys: b, TTL: time.Minute}).ValidateJWT(ctx, signed); err != nil {
+		t.Fatalf("token signed after another instance rotated: %v", err)
+	}
+
+	// b is due by its own schedule, but a rotated a moment ago
+	version := storage.set.Version
+	if err = b.RotateIfDue(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if storage.set.Version != version {
+		t.Fatal("rotated again right after another instance did")
+	}
+
+	// both instances become due at once, only one may rotate
+	interval := 50 * time.Millisecond
+	time.Sleep(interval)
+	version = storage.set.Version
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, ks := range []*Keystore{a, b} {
+		wg.Add(1)
+		go func(i int, ks *Keystore) {
+			defer wg.Done()
+			errs[i] = ks.RotateIfDue(ctx, interval)
+		}(i, ks)
+	}
+	wg.Wait()
+	if err = errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	if storage.set.Version != version+1 {
+		t.Fatalf("rotated %d times, want once", storage.set.Version-version)
+	}
+	activeA, _ := a.Active()
+	activeB, _ := b.Active()
+	if activeA != activeB {
+		t.Fatalf("instances sign with different keys: %s and %s", activeA.ID, activeB.ID)
+	}
+}
+
+// The disk variants read and parse the key on every call, as tokens were
+// handled before the keystore kept the key material in memory.
+
+func TestJWKSetDuringRotation(t *testing.T) {
+	ctx := context.Background()
+	ks, err := NewKeystore(ctx, &sharedStorage{}, AlgES256, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := ks.Rotate(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		set, err := GetJWKSet(ks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(set.Keys) == 0 {
+			t.Fatal("empty key set")
+		}
+	}
+}
+
+func benchTokens(b *testing.B, alg string) (*Tokens, KeyInfo, string) {
+	b.Helper()
+	dir := b.TempDir()
+	keys, err := OpenKeystore(dir, alg, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	active, err := keys.Active()
+	if err != nil {
+		b.Fatal(err)
+	}
+	tokens := &Tokens{Keys: keys, Issuer: "bench", Audience: []string{"bench"}, TTL: time.Minute}
+	return tokens, active, dir
+}
+
+// diskKey reads the key of kid from dir on every call, the baseline the
+// keystore's in-memory keys are measured against.
+func diskKey(dir, kid string) (crypto.PublicKey, crypto.PrivateKey, error) {
+	privBytes, err := readKeyFile(dir, kid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseKey(privateKeyFile(dir, kid), privBytes)
+}
+
+func BenchmarkGenerateJWT(b *testing.B) {
+	ctx := context.Background()
+	for _, alg := range SupportedAlgorithms {
+		tokens, active, dir := benchTokens(b, alg)
+		claims, err := tokens.NewJWTpayload("user", "session")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(alg+"/memory", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := tokens.GenerateJWT(ctx, claims); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+		b.Run(alg+"/disk", func(b *testing.B) {
+			method, err := signingMethod(alg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, priv, err := diskKey(dir, active.ID)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					token := jwt.NewWithClaims(method, claims)
+					token.Header["kid"] = active.ID
+					if _, err = token.SignedString(priv); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkValidateJWT(b *testing.B) {
+	ctx := context.Background()
+	for _, alg := range SupportedAlgorithms {
+		tokens, active, dir := benchTokens(b, alg)
+		claims, err := tokens.NewJWTpayload("user", "session")
+		if err != nil {
+			b.Fatal(err)
+		}
+		signed, err := tokens.GenerateJWT(ctx, claims)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(alg+"/memory", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := tokens.ValidateJWT(ctx, signed); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+		b.Run(alg+"/disk", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					pub, _, err := diskKey(dir, active.ID)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					_, err = jwt.ParseWithClaims(signed, &JWTpayload{}, func(*jwt.Token) (interface{}, error) {
+						return pub, nil
+					}, jwt.WithValidMethods(SupportedAlgorithms))
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
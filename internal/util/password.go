@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gomongojwt/internal/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters, the second recommended option of RFC 9106
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// dummyHash is verified against when a login doesn't exist, so the response
+// time doesn't reveal which logins are registered. It is computed on the first
+// unknown login rather than on start.
+var dummyHash = sync.OnceValues(func() (string, error) {
+	return HashPassword("dummy password")
+})
+
+// HashPassword returns an argon2id hash of password in the PHC string format.
+func HashPassword(password string) (string, error) {
+	defer metrics.ObserveHash("argon2id", "hash", time.Now())
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword reports whether password matches the argon2id hash. An empty
+// hash is checked against a dummy one and never matches.
+func VerifyPassword(password, hash string) (bool, error) {
+	if hash == "" {
+		dummy, err := dummyHash()
+		if err != nil {
+			return false, err
+		}
+		_, _ = VerifyPassword(password, dummy)
+		return false, nil
+	}
+	start := time.Now()
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrMalformedHash
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	other := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	metrics.ObserveHash("argon2id", "verify", start)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
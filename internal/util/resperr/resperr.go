@@ -3,7 +3,25 @@ package resperr
 import "errors"
 
 var (
-	ErrInvalidGUID        = errors.New("GUID input does not match any existing users")
+	ErrInvalidCredentials = errors.New("Invalid login or password")
+	ErrUserNotFound       = errors.New("User does not exist")
+	ErrUserDisabled       = errors.New("User is disabled")
 	ErrInvalidToken       = errors.New("Failed to validate Access and Refresh token pair")
 	ErrInvalidRequestBody = errors.New("Invalid request body")
+	ErrInvalidSignature   = errors.New("Access token signature is invalid")
+	ErrRefreshExpired     = errors.New("Access token is too old to be refreshed")
+	ErrRefreshMismatch    = errors.New("Refresh token does not match Access token")
+	ErrRefreshReused      = errors.New("Refresh token was already used, session has been revoked")
+	ErrSessionRevoked     = errors.New("Session has been revoked")
+	ErrRefreshConflict    = errors.New("Refresh token is already being refreshed by another request")
+	ErrSessionNotFound    = errors.New("Session not found")
+	ErrMissingToken       = errors.New("Bearer Access token is required")
+	ErrTokenRevoked       = errors.New("Access token has been revoked")
+	ErrLoginTaken         = errors.New("Login is already taken")
+	ErrAdminRequired      = errors.New("Administrator rights are required")
+	ErrInvalidQuery       = errors.New("Invalid query parameters")
+	ErrTooManyRequests    = errors.New("Too many requests, try again later")
+	ErrLockedOut          = errors.New("Too many failed attempts, try again later")
+	ErrTimeout            = errors.New("Request took too long")
+	ErrInternal           = errors.New("Internal server error")
 )